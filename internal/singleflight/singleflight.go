@@ -0,0 +1,57 @@
+// Package singleflight deduplicates concurrent calls for the same key.
+package singleflight
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Group deduplicates concurrent calls for the same key: the function is only called by the first caller,
+// the other callers wait for its result.
+// The function is called with a context that is detached from the first caller, so cancelling it doesn't fail the call
+// for the other callers, but it is bounded by the timeout given to Do.
+// The zero value is ready for use. It must not be copied after first use.
+type Group[K comparable, V any] struct {
+	mux   sync.Mutex
+	calls map[K]*call[V]
+}
+
+type call[V any] struct {
+	done   chan struct{}
+	result V
+	err    error
+}
+
+// Do calls fn for the key, unless a call for the key is already in progress, and returns its result.
+// It returns early with the context error if ctx is done before the call finished.
+func (g *Group[K, V]) Do(ctx context.Context, key K, timeout time.Duration, fn func(ctx context.Context) (V, error)) (V, error) {
+	g.mux.Lock()
+	if g.calls == nil {
+		g.calls = make(map[K]*call[V])
+	}
+	c, ok := g.calls[key]
+	if !ok {
+		c = &call[V]{done: make(chan struct{})}
+		g.calls[key] = c
+		go g.call(context.WithoutCancel(ctx), key, timeout, c, fn)
+	}
+	g.mux.Unlock()
+	select {
+	case <-c.done:
+		return c.result, c.err
+	case <-ctx.Done():
+		var empty V
+		return empty, ctx.Err()
+	}
+}
+
+func (g *Group[K, V]) call(ctx context.Context, key K, timeout time.Duration, c *call[V], fn func(ctx context.Context) (V, error)) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	c.result, c.err = fn(ctx)
+	g.mux.Lock()
+	delete(g.calls, key)
+	g.mux.Unlock()
+	close(c.done)
+}
@@ -0,0 +1,67 @@
+package singleflight
+
+import (
+	"context"
+	"github.com/stretchr/testify/require"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestGroup_Do(t *testing.T) {
+	t.Run("concurrent calls are deduplicated", func(t *testing.T) {
+		var group Group[string, int]
+		var calls atomic.Int32
+		release := make(chan struct{})
+		fn := func(ctx context.Context) (int, error) {
+			calls.Add(1)
+			<-release
+			return 42, nil
+		}
+		var wg sync.WaitGroup
+		results := make([]int, 5)
+		for i := range results {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				results[i], _ = group.Do(context.Background(), "key", time.Minute, fn)
+			}()
+		}
+		time.Sleep(10 * time.Millisecond)
+
+		close(release)
+		wg.Wait()
+
+		require.Equal(t, int32(1), calls.Load())
+		require.Equal(t, []int{42, 42, 42, 42, 42}, results)
+	})
+	t.Run("cancelled caller doesn't cancel the call", func(t *testing.T) {
+		var group Group[string, int]
+		release := make(chan struct{})
+		fn := func(ctx context.Context) (int, error) {
+			<-release
+			return 42, ctx.Err()
+		}
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		_, err := group.Do(ctx, "key", time.Minute, fn)
+		require.ErrorIs(t, err, context.Canceled)
+
+		close(release)
+		result, err := group.Do(context.Background(), "key", time.Minute, fn)
+
+		require.NoError(t, err)
+		require.Equal(t, 42, result)
+	})
+	t.Run("timeout", func(t *testing.T) {
+		var group Group[string, int]
+
+		_, err := group.Do(context.Background(), "key", time.Millisecond, func(ctx context.Context) (int, error) {
+			<-ctx.Done()
+			return 0, ctx.Err()
+		})
+
+		require.ErrorIs(t, err, context.DeadlineExceeded)
+	})
+}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"github.com/nuts-foundation/go-did/vc"
 	"github.com/nuts-foundation/go-nuts-client/nuts/iam"
+	"github.com/nuts-foundation/go-nuts-client/nuts/vcr"
 	"github.com/nuts-foundation/go-nuts-client/oauth2"
 	"net/http"
 	"net/url"
@@ -41,7 +42,7 @@ func (o OAuth2TokenSource) Token(httpRequest *http.Request, authzServerURL *url.
 	if credsCtx, ok := httpRequest.Context().Value(additionalCredentialsKey).([]vc.VerifiableCredential); ok {
 		additionalCredentials = credsCtx
 	}
-	client, err := iam.NewClient(o.NutsAPIURL)
+	client, err := newIAMClient(o.NutsAPIURL, o.NutsHttpClient)
 	if err != nil {
 		return nil, err
 	}
@@ -64,16 +65,36 @@ func (o OAuth2TokenSource) Token(httpRequest *http.Request, authzServerURL *url.
 	if accessTokenResponse.JSON200 == nil {
 		return nil, fmt.Errorf("failed service access token response: %s", accessTokenResponse.HTTPResponse.Status)
 	}
+	return toOAuth2Token(*accessTokenResponse.JSON200), nil
+}
+
+func newIAMClient(nutsAPIURL string, httpClient *http.Client) (*iam.Client, error) {
+	var opts []iam.ClientOption
+	if httpClient != nil {
+		opts = append(opts, iam.WithHTTPClient(httpClient))
+	}
+	return iam.NewClient(nutsAPIURL, opts...)
+}
+
+func newVCRClient(nutsAPIURL string, httpClient *http.Client) (*vcr.Client, error) {
+	var opts []vcr.ClientOption
+	if httpClient != nil {
+		opts = append(opts, vcr.WithHTTPClient(httpClient))
+	}
+	return vcr.NewClient(nutsAPIURL, opts...)
+}
+
+func toOAuth2Token(response iam.TokenResponse) *oauth2.Token {
 	var expiry *time.Time
-	if accessTokenResponse.JSON200.ExpiresIn != nil {
+	if response.ExpiresIn != nil {
 		expiry = new(time.Time)
-		*expiry = time.Now().Add(time.Duration(*accessTokenResponse.JSON200.ExpiresIn) * time.Second)
+		*expiry = time.Now().Add(time.Duration(*response.ExpiresIn) * time.Second)
 	}
 	return &oauth2.Token{
-		AccessToken: accessTokenResponse.JSON200.AccessToken,
-		TokenType:   accessTokenResponse.JSON200.TokenType,
+		AccessToken: response.AccessToken,
+		TokenType:   response.TokenType,
 		Expiry:      expiry,
-	}, nil
+	}
 }
 
 type additionalCredentialsKeyType struct{}
@@ -85,3 +106,36 @@ var additionalCredentialsKey = additionalCredentialsKeyType{}
 func WithAdditionalCredentials(ctx context.Context, credentials []vc.VerifiableCredential) context.Context {
 	return context.WithValue(ctx, additionalCredentialsKey, credentials)
 }
+
+type partnerKeyType struct{}
+
+var partnerKey = partnerKeyType{}
+
+type partner struct {
+	did       string
+	subjectID string
+}
+
+// WithPartnerDID returns a new context with the DID of the organization a request is sent to.
+// It is used by Authorization Server locators to find the partner's Authorization Server, e.g. through its DID document.
+func WithPartnerDID(ctx context.Context, did string) context.Context {
+	return context.WithValue(ctx, partnerKey, partner{did: did})
+}
+
+// WithPartnerSubject returns a new context with the ID of the subject the request is sent to,
+// for partners that are a subject on the local Nuts node (see WithPartnerDID).
+func WithPartnerSubject(ctx context.Context, subjectID string) context.Context {
+	return context.WithValue(ctx, partnerKey, partner{subjectID: subjectID})
+}
+
+// PartnerDID returns the DID of the partner specified with WithPartnerDID, or an empty string if not specified.
+func PartnerDID(ctx context.Context) string {
+	p, _ := ctx.Value(partnerKey).(partner)
+	return p.did
+}
+
+// PartnerSubject returns the ID of the partner subject specified with WithPartnerSubject, or an empty string if not specified.
+func PartnerSubject(ctx context.Context) string {
+	p, _ := ctx.Value(partnerKey).(partner)
+	return p.subjectID
+}
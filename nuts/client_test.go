@@ -71,4 +71,38 @@ func TestOAuth2TokenSource_Token(t *testing.T) {
 		require.Equal(t, "bearer", token.TokenType)
 		require.NotEmpty(t, capturedRequest.Credentials)
 	})
+	t.Run("custom HTTP client", func(t *testing.T) {
+		mux := http.NewServeMux()
+		var capturedHeader string
+		mux.HandleFunc("/internal/auth/v2/123abc/request-service-access-token", func(w http.ResponseWriter, r *http.Request) {
+			capturedHeader = r.Header.Get("X-Test")
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusOK)
+			_, _ = w.Write([]byte(`{"access_token":"test","token_type":"bearer","expires_in":3600}`))
+		})
+		httpServer := httptest.NewServer(mux)
+		tokenSource := OAuth2TokenSource{
+			NutsSubject:    "123abc",
+			NutsAPIURL:     httpServer.URL,
+			NutsHttpClient: &http.Client{Transport: headerTransport{key: "X-Test", value: "custom"}},
+		}
+		expectedAuthServerURL, _ := url.Parse("https://auth.example.com")
+		httpRequest, _ := http.NewRequestWithContext(context.Background(), "GET", "https://resource.example.com", nil)
+
+		_, err := tokenSource.Token(httpRequest, expectedAuthServerURL, "test")
+
+		require.NoError(t, err)
+		require.Equal(t, "custom", capturedHeader)
+	})
+}
+
+type headerTransport struct {
+	key   string
+	value string
+}
+
+func (h headerTransport) RoundTrip(request *http.Request) (*http.Response, error) {
+	request = request.Clone(request.Context())
+	request.Header.Set(h.key, h.value)
+	return http.DefaultTransport.RoundTrip(request)
 }
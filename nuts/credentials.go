@@ -0,0 +1,208 @@
+package nuts
+
+import (
+	"errors"
+	"fmt"
+	ssi "github.com/nuts-foundation/go-did"
+	"github.com/nuts-foundation/go-did/vc"
+	"github.com/nuts-foundation/go-nuts-client/nuts/vcr"
+	"strings"
+	"time"
+)
+
+// NutsCredentialsContext is the JSON-LD context that defines the Nuts credential types (e.g. NutsOrganizationCredential).
+var NutsCredentialsContext = ssi.MustParseURI("https://nuts.nl/credentials/v1")
+
+var _ CredentialProvider = CredentialBuilder{}
+
+// CredentialBuilder builds a Verifiable Credential template for a given credential type.
+// The template can be presented as self-attested credential (see WithAdditionalCredentials),
+// or be issued into a wallet by the Nuts node (see IssueRequest).
+// The W3C Verifiable Credentials context and the VerifiableCredential type are always added.
+type CredentialBuilder struct {
+	// Context contains the JSON-LD contexts that define the credential type and its subject fields.
+	Context []ssi.URI
+	// Type contains the credential type, e.g. NutsOrganizationCredential.
+	Type []ssi.URI
+	// Subject contains the fields of the credentialSubject.
+	Subject map[string]interface{}
+	// RequiredFields contains the subject fields that must be present and non-empty, in dot notation (e.g. organization.name).
+	RequiredFields []string
+	// ExpirationDate is the optional expirationDate of the credential.
+	ExpirationDate *time.Time
+
+	// err contains the error that occurred while constructing the builder, which is returned by Validate.
+	err error
+}
+
+// NewCredentialBuilder returns a CredentialBuilder for a custom credential type, defined by the given JSON-LD context.
+// If the credential type is invalid, Validate (and thus BuildCredentials and IssueRequest) returns an error.
+func NewCredentialBuilder(context ssi.URI, credentialType string, subject map[string]interface{}, requiredFields ...string) CredentialBuilder {
+	result := CredentialBuilder{
+		Context:        []ssi.URI{context},
+		Subject:        subject,
+		RequiredFields: requiredFields,
+	}
+	parsedType, err := ssi.ParseURI(credentialType)
+	if err != nil {
+		result.err = fmt.Errorf("invalid credential type %s: %w", credentialType, err)
+	} else {
+		result.Type = []ssi.URI{*parsedType}
+	}
+	return result
+}
+
+// OrganizationCredential returns a CredentialBuilder for a NutsOrganizationCredential.
+func OrganizationCredential(name string, city string) CredentialBuilder {
+	return NewCredentialBuilder(NutsCredentialsContext, "NutsOrganizationCredential", map[string]interface{}{
+		"organization": map[string]interface{}{
+			"name": name,
+			"city": city,
+		},
+	}, "organization.name", "organization.city")
+}
+
+// UraCredential returns a CredentialBuilder for a NutsUraCredential,
+// which binds an organization to its URA (UZI Register Abonneenummer).
+func UraCredential(ura string, name string, city string) CredentialBuilder {
+	return NewCredentialBuilder(NutsCredentialsContext, "NutsUraCredential", map[string]interface{}{
+		"organization": map[string]interface{}{
+			"ura":  ura,
+			"name": name,
+			"city": city,
+		},
+	}, "organization.ura", "organization.name")
+}
+
+// PatientEnrollmentCredential returns a CredentialBuilder for a credential that states the patient is enrolled in
+// (or consented to) the given purpose of use, e.g. a care pathway.
+// The credential type is not defined by the Nuts context, so the JSON-LD context that defines it must be given.
+func PatientEnrollmentCredential(context ssi.URI, credentialType string, patientID string, purpose string) CredentialBuilder {
+	return NewCredentialBuilder(context, credentialType, map[string]interface{}{
+		"patient": map[string]interface{}{
+			"identifier": patientID,
+		},
+		"purposeOfUse": purpose,
+	}, "patient.identifier", "purposeOfUse")
+}
+
+// WithExpirationDate returns a copy of the builder with the given expirationDate.
+func (b CredentialBuilder) WithExpirationDate(expirationDate time.Time) CredentialBuilder {
+	b.ExpirationDate = &expirationDate
+	return b
+}
+
+// Validate checks that the builder specifies a credential type and that all required subject fields are set.
+func (b CredentialBuilder) Validate() error {
+	if b.err != nil {
+		return b.err
+	}
+	if len(b.Context) == 0 {
+		return errors.New("credential context is required")
+	}
+	if len(b.Type) == 0 {
+		return errors.New("credential type is required")
+	}
+	var errs []error
+	for _, field := range b.RequiredFields {
+		if isEmptyValue(lookupField(b.Subject, field)) {
+			errs = append(errs, fmt.Errorf("credentialSubject.%s is required", field))
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("invalid %s: %w", b.Type[0], errors.Join(errs...))
+	}
+	return nil
+}
+
+// Credentials returns the credential template. The Nuts node fills in the issuer, subject ID and issuanceDate.
+// It does not validate the builder, use Validate or BuildCredentials for that.
+func (b CredentialBuilder) Credentials() []vc.VerifiableCredential {
+	subject := make(map[string]interface{}, len(b.Subject))
+	for key, value := range b.Subject {
+		subject[key] = value
+	}
+	return []vc.VerifiableCredential{
+		{
+			Context:           append([]ssi.URI{vc.VCContextV1URI()}, b.Context...),
+			Type:              append([]ssi.URI{vc.VerifiableCredentialTypeV1URI()}, b.Type...),
+			ExpirationDate:    b.ExpirationDate,
+			CredentialSubject: []interface{}{subject},
+		},
+	}
+}
+
+// IssueRequest returns a request for the Nuts node to issue the credential to the given holder (DID), e.g. to store it in the holder's wallet.
+func (b CredentialBuilder) IssueRequest(issuer string, holder string) (*vcr.IssueVCRequest, error) {
+	if err := b.Validate(); err != nil {
+		return nil, err
+	}
+	if issuer == "" || holder == "" {
+		return nil, errors.New("issuer and holder are required")
+	}
+	subject := b.Credentials()[0].CredentialSubject[0].(map[string]interface{})
+	subject["id"] = holder
+	result := vcr.IssueVCRequest{
+		CredentialSubject: subject,
+		Issuer:            issuer,
+	}
+	var contexts []string
+	for _, context := range b.Context {
+		contexts = append(contexts, context.String())
+	}
+	result.Context = new(vcr.IssueVCRequest_Context)
+	if err := result.Context.FromIssueVCRequestContext1(contexts); err != nil {
+		return nil, err
+	}
+	var types []string
+	for _, credentialType := range b.Type {
+		types = append(types, credentialType.String())
+	}
+	if err := result.Type.FromIssueVCRequestType1(types); err != nil {
+		return nil, err
+	}
+	if b.ExpirationDate != nil {
+		expirationDate := b.ExpirationDate.Format(time.RFC3339)
+		result.ExpirationDate = &expirationDate
+	}
+	return &result, nil
+}
+
+// BuildCredentials validates the given providers (if they support validation) and returns all their credentials,
+// so they can be passed to WithAdditionalCredentials.
+func BuildCredentials(providers ...CredentialProvider) ([]vc.VerifiableCredential, error) {
+	var result []vc.VerifiableCredential
+	for _, provider := range providers {
+		if v, ok := provider.(interface{ Validate() error }); ok {
+			if err := v.Validate(); err != nil {
+				return nil, err
+			}
+		}
+		result = append(result, provider.Credentials()...)
+	}
+	return result, nil
+}
+
+// lookupField returns the value of a field in dot notation (e.g. organization.name) from a (nested) map.
+func lookupField(subject map[string]interface{}, path string) interface{} {
+	var current interface{} = subject
+	for _, part := range strings.Split(path, ".") {
+		asMap, ok := current.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		current = asMap[part]
+	}
+	return current
+}
+
+func isEmptyValue(value interface{}) bool {
+	switch v := value.(type) {
+	case nil:
+		return true
+	case string:
+		return strings.TrimSpace(v) == ""
+	default:
+		return false
+	}
+}
@@ -0,0 +1,133 @@
+package nuts
+
+import (
+	"encoding/json"
+	ssi "github.com/nuts-foundation/go-did"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestCredentialBuilder_Credentials(t *testing.T) {
+	t.Run("NutsOrganizationCredential", func(t *testing.T) {
+		credentials := OrganizationCredential("Hospital", "Amsterdam").Credentials()
+
+		require.Len(t, credentials, 1)
+		credential := credentials[0]
+		require.Equal(t, []ssi.URI{
+			ssi.MustParseURI("https://www.w3.org/2018/credentials/v1"),
+			ssi.MustParseURI("https://nuts.nl/credentials/v1"),
+		}, credential.Context)
+		require.Equal(t, []ssi.URI{
+			ssi.MustParseURI("VerifiableCredential"),
+			ssi.MustParseURI("NutsOrganizationCredential"),
+		}, credential.Type)
+		require.Nil(t, credential.ExpirationDate)
+		require.Equal(t, map[string]interface{}{
+			"organization": map[string]interface{}{
+				"name": "Hospital",
+				"city": "Amsterdam",
+			},
+		}, credential.CredentialSubject[0])
+	})
+	t.Run("custom credential with expirationDate", func(t *testing.T) {
+		expirationDate := time.Now().Add(time.Hour)
+		builder := NewCredentialBuilder(ssi.MustParseURI("https://example.com/v1"), "CustomCredential", map[string]interface{}{
+			"foo": "bar",
+		}, "foo").WithExpirationDate(expirationDate)
+
+		credential := builder.Credentials()[0]
+
+		require.NoError(t, builder.Validate())
+		require.Equal(t, "https://example.com/v1", credential.Context[1].String())
+		require.Equal(t, "CustomCredential", credential.Type[1].String())
+		require.Equal(t, expirationDate, *credential.ExpirationDate)
+	})
+	t.Run("EmployeeDetails", func(t *testing.T) {
+		credential := EmployeeDetails{Id: "1", Name: "John", Role: "Nurse"}.Credentials()[0]
+
+		require.Equal(t, "EmployeeCredential", credential.Type[1].String())
+		require.Equal(t, map[string]interface{}{
+			"identifier": "1",
+			"name":       "John",
+			"roleName":   "Nurse",
+		}, credential.CredentialSubject[0])
+	})
+}
+
+func TestCredentialBuilder_Validate(t *testing.T) {
+	t.Run("ok", func(t *testing.T) {
+		require.NoError(t, UraCredential("123", "Hospital", "").Validate())
+	})
+	t.Run("missing required fields", func(t *testing.T) {
+		err := PatientEnrollmentCredential(ssi.MustParseURI("https://example.com/v1"), "PatientEnrollmentCredential", " ", "").Validate()
+
+		require.EqualError(t, err, "invalid PatientEnrollmentCredential: credentialSubject.patient.identifier is required\ncredentialSubject.purposeOfUse is required")
+	})
+	t.Run("invalid type", func(t *testing.T) {
+		builder := NewCredentialBuilder(NutsCredentialsContext, "Employee%Credential", map[string]interface{}{})
+
+		err := builder.Validate()
+
+		require.ErrorContains(t, err, "invalid credential type Employee%Credential")
+		_, err = BuildCredentials(builder)
+		require.ErrorContains(t, err, "invalid credential type Employee%Credential")
+	})
+	t.Run("missing type", func(t *testing.T) {
+		err := CredentialBuilder{Context: []ssi.URI{NutsCredentialsContext}}.Validate()
+
+		require.EqualError(t, err, "credential type is required")
+	})
+	t.Run("EmployeeDetails", func(t *testing.T) {
+		err := EmployeeDetails{Id: "1", Name: "John"}.Validate()
+
+		require.EqualError(t, err, "invalid EmployeeCredential: credentialSubject.roleName is required")
+	})
+}
+
+func TestCredentialBuilder_IssueRequest(t *testing.T) {
+	t.Run("ok", func(t *testing.T) {
+		expirationDate := time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)
+
+		request, err := OrganizationCredential("Hospital", "Amsterdam").
+			WithExpirationDate(expirationDate).
+			IssueRequest("did:web:issuer.example.com", "did:web:holder.example.com")
+
+		require.NoError(t, err)
+		data, _ := json.Marshal(request)
+		require.JSONEq(t, `{
+			"@context": ["https://nuts.nl/credentials/v1"],
+			"type": ["NutsOrganizationCredential"],
+			"issuer": "did:web:issuer.example.com",
+			"expirationDate": "2030-01-01T00:00:00Z",
+			"credentialSubject": {
+				"id": "did:web:holder.example.com",
+				"organization": {"name": "Hospital", "city": "Amsterdam"}
+			}
+		}`, string(data))
+	})
+	t.Run("invalid", func(t *testing.T) {
+		_, err := OrganizationCredential("", "Amsterdam").IssueRequest("did:web:issuer.example.com", "did:web:holder.example.com")
+
+		require.EqualError(t, err, "invalid NutsOrganizationCredential: credentialSubject.organization.name is required")
+	})
+	t.Run("missing holder", func(t *testing.T) {
+		_, err := OrganizationCredential("Hospital", "Amsterdam").IssueRequest("did:web:issuer.example.com", "")
+
+		require.EqualError(t, err, "issuer and holder are required")
+	})
+}
+
+func TestBuildCredentials(t *testing.T) {
+	t.Run("ok", func(t *testing.T) {
+		credentials, err := BuildCredentials(EmployeeDetails{Id: "1", Name: "John", Role: "Nurse"}, OrganizationCredential("Hospital", "Amsterdam"))
+
+		require.NoError(t, err)
+		require.Len(t, credentials, 2)
+	})
+	t.Run("invalid", func(t *testing.T) {
+		_, err := BuildCredentials(EmployeeDetails{})
+
+		require.Error(t, err)
+	})
+}
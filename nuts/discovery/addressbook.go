@@ -0,0 +1,172 @@
+package discovery
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	ssi "github.com/nuts-foundation/go-did"
+	"github.com/nuts-foundation/go-did/vc"
+	"github.com/nuts-foundation/go-nuts-client/nuts"
+	"github.com/nuts-foundation/go-nuts-client/nuts/vdr"
+	"github.com/nuts-foundation/go-nuts-client/oauth2"
+	"net/url"
+	"slices"
+)
+
+// DefaultFHIREndpoint is the name of the endpoint that holds the FHIR base URL of an organization if AddressBook.FHIREndpoint is not set.
+const DefaultFHIREndpoint = "fhirBaseURL"
+
+// AddressBook looks up organizations registered on a Discovery Service, and the endpoints to contact them.
+type AddressBook struct {
+	// Client is the client of the Discovery API of the Nuts node.
+	Client ClientInterface
+	// VDRClient is the client of the VDR API of the Nuts node, used to resolve the DID documents of the organizations.
+	// If not set, only the endpoints in the registration parameters are returned.
+	VDRClient vdr.ClientInterface
+	// ServiceID is the ID of the Discovery Service to search.
+	ServiceID string
+	// Replica is optionally used to search a local replica of the Discovery Service, instead of the Nuts node.
+	Replica *Replica
+	// FHIREndpoint is the name of the registration parameter or DID document service type that holds the FHIR base URL.
+	// If not set, DefaultFHIREndpoint is used.
+	FHIREndpoint string
+}
+
+// Organization is an organization found in an AddressBook.
+type Organization struct {
+	// Organization contains the name, city and URA of the organization, as described by its credentials.
+	nuts.Organization
+	// DIDs contains the DIDs the organization registered on the Discovery Service with, in alphabetical order.
+	DIDs []string
+	// AuthServerURL is the URL of the organization's OAuth2 Authorization Server.
+	AuthServerURL string
+	// FHIRBaseURL is the base URL of the organization's FHIR API, if registered.
+	FHIRBaseURL string
+	// Endpoints contains the URLs of the organization's endpoints, by registration parameter name or DID document service type.
+	// Registration parameters take precedence over DID document services.
+	Endpoints map[string]string
+	// Credentials contains the credentials the organization registered on the Discovery Service (except the DiscoveryRegistrationCredential).
+	Credentials []vc.VerifiableCredential
+	// Err contains the errors that occurred while resolving the organization's DID documents.
+	// Endpoints then lacks the services of the DID documents that couldn't be resolved.
+	Err error
+}
+
+// WithResourceURI returns a new context with the organization's FHIR base URL as resource URI (see oauth2.WithResourceURI),
+// so an OAuth2 client (see oauth2.NewClient) can locate its Authorization Server through the protected resource metadata.
+// If the organization has no FHIR base URL, the context is returned unchanged.
+func (o Organization) WithResourceURI(ctx context.Context) context.Context {
+	if o.FHIRBaseURL == "" {
+		return ctx
+	}
+	return oauth2.WithResourceURI(ctx, o.FHIRBaseURL)
+}
+
+// Lookup returns the organizations registered on the Discovery Service that match the query,
+// e.g. NewQuery().Equals("credentialSubject.organization.ura", "12345").
+// An organization (subject) registers a presentation per DID; these are combined by Authorization Server URL,
+// which the Nuts node specifies per subject.
+// Failures to resolve the DID documents of an organization don't fail the lookup, but are reported in Organization.Err.
+func (a AddressBook) Lookup(ctx context.Context, query Query) ([]Organization, error) {
+	var results []SearchResult
+	var err error
+	if a.Replica != nil {
+		results, err = a.Replica.Search(query)
+	} else {
+		results, err = Search(ctx, a.Client, a.ServiceID, query)
+	}
+	if err != nil {
+		return nil, err
+	}
+	var organizations []*Organization
+	byAuthServerURL := make(map[string]*Organization)
+	for _, result := range results {
+		authServerURL, _ := result.RegistrationParameters["authServerURL"].(string)
+		organization := byAuthServerURL[authServerURL]
+		if organization == nil || authServerURL == "" {
+			organization = &Organization{AuthServerURL: authServerURL, Endpoints: make(map[string]string)}
+			byAuthServerURL[authServerURL] = organization
+			organizations = append(organizations, organization)
+		}
+		if err := organization.add(result); err != nil {
+			return nil, fmt.Errorf("presentation %s: %w", result.Id, err)
+		}
+	}
+	var resolved []Organization
+	for _, organization := range organizations {
+		slices.Sort(organization.DIDs)
+		if a.VDRClient != nil {
+			organization.Err = a.addServices(ctx, organization)
+		}
+		organization.FHIRBaseURL = organization.Endpoints[a.fhirEndpoint()]
+		resolved = append(resolved, *organization)
+	}
+	return resolved, nil
+}
+
+func (a AddressBook) fhirEndpoint() string {
+	if a.FHIREndpoint == "" {
+		return DefaultFHIREndpoint
+	}
+	return a.FHIREndpoint
+}
+
+// addServices adds the endpoints of the DID documents of the organization, which aren't specified by the registration parameters.
+// DID documents that can't be resolved are skipped; the returned error joins their errors.
+func (a AddressBook) addServices(ctx context.Context, organization *Organization) error {
+	var errs []error
+	for _, did := range organization.DIDs {
+		httpResponse, err := a.VDRClient.ResolveDID(ctx, did)
+		response, err := nuts.ParseResponse(err, httpResponse, vdr.ParseResolveDIDResponse)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("resolve DID %s: %w", did, err))
+			continue
+		}
+		if response.JSON200 == nil {
+			errs = append(errs, fmt.Errorf("failed resolve DID %s response: %s", did, response.Status()))
+			continue
+		}
+		for _, service := range response.JSON200.Document.Service {
+			if _, exists := organization.Endpoints[service.Type]; exists {
+				continue
+			}
+			if endpoint, err := vdr.DecodeEndpointURL(service.ServiceEndpoint); err == nil {
+				organization.Endpoints[service.Type] = endpoint.String()
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (o *Organization) add(result SearchResult) error {
+	if !slices.Contains(o.DIDs, result.CredentialSubjectId) {
+		o.DIDs = append(o.DIDs, result.CredentialSubjectId)
+	}
+	for name, value := range result.RegistrationParameters {
+		if endpoint, ok := value.(string); ok && name != "authServerURL" && isURL(endpoint) {
+			o.Endpoints[name] = endpoint
+		}
+	}
+	for _, credential := range result.Vp.VerifiableCredential {
+		if credential.IsType(ssi.MustParseURI("DiscoveryRegistrationCredential")) {
+			continue
+		}
+		o.Credentials = append(o.Credentials, credential)
+		var subjects []struct {
+			Organization nuts.Organization `json:"organization"`
+		}
+		if err := credential.UnmarshalCredentialSubject(&subjects); err != nil {
+			return fmt.Errorf("invalid credential: %w", err)
+		}
+		if len(subjects) > 0 {
+			o.Organization.Merge(subjects[0].Organization)
+		}
+	}
+	return nil
+}
+
+// isURL reports whether the value is an absolute URL.
+func isURL(value string) bool {
+	u, err := url.Parse(value)
+	return err == nil && u.IsAbs() && u.Host != ""
+}
@@ -0,0 +1,149 @@
+package discovery
+
+import (
+	"context"
+	"github.com/nuts-foundation/go-nuts-client/nuts"
+	"github.com/nuts-foundation/go-nuts-client/nuts/vdr"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func organizationPresentation(did string, organization string) string {
+	return `{
+  "@context": ["https://www.w3.org/2018/credentials/v1"],
+  "type": "VerifiablePresentation",
+  "holder": "` + did + `",
+  "verifiableCredential": [{
+    "@context": ["https://www.w3.org/2018/credentials/v1", "https://nuts.nl/credentials/v1"],
+    "type": ["VerifiableCredential", "NutsOrganizationCredential"],
+    "issuer": "did:web:issuer.example.com",
+    "issuanceDate": "2024-01-01T00:00:00Z",
+    "credentialSubject": {"id": "` + did + `", "organization": ` + organization + `}
+  }, {
+    "@context": ["https://www.w3.org/2018/credentials/v1", "https://nuts.nl/credentials/v1"],
+    "type": ["VerifiableCredential", "DiscoveryRegistrationCredential"],
+    "issuer": "` + did + `",
+    "issuanceDate": "2024-01-01T00:00:00Z",
+    "credentialSubject": {"id": "` + did + `", "authServerURL": "https://example.com/oauth2/hospital"}
+  }]
+}`
+}
+
+func TestAddressBook_Lookup(t *testing.T) {
+	handler := http.NewServeMux()
+	handler.HandleFunc("GET /internal/discovery/v1/{serviceID}", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		if r.URL.Query().Get("credentialSubject.organization.ura") != "1234" {
+			_, _ = w.Write([]byte(`[]`))
+			return
+		}
+		_, _ = w.Write([]byte(`[
+  {
+    "id": "did:web:example.com:iam:hospital#1",
+    "credential_subject_id": "did:web:example.com:iam:hospital",
+    "fields": {},
+    "registrationParameters": {"authServerURL": "https://example.com/oauth2/hospital", "fhirBaseURL": "https://example.com/fhir", "weight": 1},
+    "vp": ` + organizationPresentation("did:web:example.com:iam:hospital", `{"name": "Hospital", "city": "Amsterdam"}`) + `
+  },
+  {
+    "id": "did:nuts:hospital#1",
+    "credential_subject_id": "did:nuts:hospital",
+    "fields": {},
+    "registrationParameters": {"authServerURL": "https://example.com/oauth2/hospital"},
+    "vp": ` + organizationPresentation("did:nuts:hospital", `{"ura": "1234"}`) + `
+  }
+]`))
+	})
+	unresolvable := ""
+	handler.HandleFunc("GET /internal/vdr/v2/did/{did}", func(w http.ResponseWriter, r *http.Request) {
+		if r.PathValue("did") == unresolvable {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte(`{
+  "document": {
+    "@context": "https://www.w3.org/ns/did/v1",
+    "id": "` + r.PathValue("did") + `",
+    "service": [
+      {"id": "` + r.PathValue("did") + `#fhir", "type": "fhirBaseURL", "serviceEndpoint": "https://other.example.com/fhir"},
+      {"id": "` + r.PathValue("did") + `#notification", "type": "notification", "serviceEndpoint": "https://example.com/notify"},
+      {"id": "` + r.PathValue("did") + `#contact", "type": "contact", "serviceEndpoint": {"email": "info@example.com"}},
+      {"id": "` + r.PathValue("did") + `#audit", "type": "audit", "serviceEndpoint": ["https://example.com/audit"]}
+    ]
+  },
+  "documentMetadata": {}
+}`))
+	})
+	httpServer := httptest.NewServer(handler)
+	client, _ := NewClient(httpServer.URL)
+	vdrClient, _ := vdr.NewClient(httpServer.URL)
+	query := NewQuery().Equals("credentialSubject.organization.ura", "1234")
+
+	t.Run("ok", func(t *testing.T) {
+		addressBook := AddressBook{Client: client, VDRClient: vdrClient, ServiceID: "care"}
+
+		organizations, err := addressBook.Lookup(context.Background(), query)
+
+		require.NoError(t, err)
+		require.Len(t, organizations, 1)
+		organization := organizations[0]
+		require.Equal(t, nuts.Organization{Name: "Hospital", City: "Amsterdam", URA: "1234"}, organization.Organization)
+		require.Equal(t, []string{"did:nuts:hospital", "did:web:example.com:iam:hospital"}, organization.DIDs)
+		require.Equal(t, "https://example.com/oauth2/hospital", organization.AuthServerURL)
+		require.Equal(t, "https://example.com/fhir", organization.FHIRBaseURL)
+		require.Equal(t, map[string]string{
+			"fhirBaseURL":  "https://example.com/fhir",
+			"notification": "https://example.com/notify",
+			"audit":        "https://example.com/audit",
+		}, organization.Endpoints)
+		require.Len(t, organization.Credentials, 2)
+		require.NoError(t, organization.Err)
+	})
+	t.Run("unresolvable DID", func(t *testing.T) {
+		unresolvable = "did:nuts:hospital"
+		defer func() { unresolvable = "" }()
+		addressBook := AddressBook{Client: client, VDRClient: vdrClient, ServiceID: "care"}
+
+		organizations, err := addressBook.Lookup(context.Background(), query)
+
+		require.NoError(t, err)
+		require.Len(t, organizations, 1)
+		require.ErrorContains(t, organizations[0].Err, "resolve DID did:nuts:hospital")
+		require.Equal(t, "https://example.com/notify", organizations[0].Endpoints["notification"])
+	})
+	t.Run("without VDR client", func(t *testing.T) {
+		addressBook := AddressBook{Client: client, ServiceID: "care", FHIREndpoint: "notification"}
+
+		organizations, err := addressBook.Lookup(context.Background(), query)
+
+		require.NoError(t, err)
+		require.Equal(t, map[string]string{"fhirBaseURL": "https://example.com/fhir"}, organizations[0].Endpoints)
+		require.Empty(t, organizations[0].FHIRBaseURL)
+	})
+	t.Run("no results", func(t *testing.T) {
+		addressBook := AddressBook{Client: client, VDRClient: vdrClient, ServiceID: "care"}
+
+		organizations, err := addressBook.Lookup(context.Background(), NewQuery().Equals("credentialSubject.organization.ura", "5678"))
+
+		require.NoError(t, err)
+		require.Empty(t, organizations)
+	})
+}
+
+func TestOrganization_WithResourceURI(t *testing.T) {
+	t.Run("ok", func(t *testing.T) {
+		ctx := Organization{FHIRBaseURL: "https://example.com/fhir"}.WithResourceURI(context.Background())
+
+		require.NotEqual(t, context.Background(), ctx)
+	})
+	t.Run("no FHIR base URL", func(t *testing.T) {
+		ctx := Organization{}.WithResourceURI(context.Background())
+
+		require.Equal(t, context.Background(), ctx)
+	})
+}
@@ -0,0 +1,167 @@
+package discovery
+
+import (
+	"context"
+	"fmt"
+	"github.com/nuts-foundation/go-did/vc"
+	"github.com/nuts-foundation/go-nuts-client/nuts"
+	"github.com/nuts-foundation/go-nuts-client/nuts/pe"
+	"github.com/nuts-foundation/go-nuts-client/nuts/vcr"
+	"slices"
+)
+
+// RegistrationAnalysis describes whether a subject's wallet contains the credentials required to register on a Discovery Service.
+type RegistrationAnalysis struct {
+	ServiceID string
+	SubjectID string
+	// Satisfied indicates whether the credentials of at least one DID of the subject satisfy the presentation definition
+	// of the Discovery Service, so the Nuts node can register a presentation for that DID.
+	Satisfied bool
+	// Missing contains the input descriptors of the presentation definition that aren't satisfied
+	// for the DID that came closest to satisfying it (or for any DID, if the wallet contains no credentials).
+	// It is empty if Satisfied is true.
+	Missing []MissingCredential
+	// DIDs contains the analysis per DID that credentials in the wallet are issued to, ordered by DID.
+	DIDs []DIDRegistrationAnalysis
+}
+
+// DIDRegistrationAnalysis describes whether the credentials of a single DID of the subject satisfy the presentation definition.
+type DIDRegistrationAnalysis struct {
+	DID       string
+	Satisfied bool
+	Missing   []MissingCredential
+}
+
+// MissingCredential describes a credential the subject needs to obtain, derived from an unsatisfied input descriptor.
+type MissingCredential struct {
+	InputDescriptorID string
+	// Name and Purpose are the human-readable name and purpose of the input descriptor, if specified.
+	Name    string
+	Purpose string
+	// CredentialTypes contains the credential types the input descriptor accepts (any of them), if it restricts the type.
+	CredentialTypes []string
+	// Fields contains the required fields of the credential (other than its type), by field ID or JSONPath.
+	Fields []string
+	// Reason describes why the credential in the wallet that came closest doesn't satisfy the input descriptor.
+	Reason string
+}
+
+// AnalyzeRegistration checks which credentials the subject's wallet lacks to register on the Discovery Service,
+// by evaluating the service's presentation definition against the credentials in the wallet.
+// The Nuts node creates a presentation per DID of the subject, with the credentials issued to that DID,
+// so the definition is evaluated per DID (see RegistrationAnalysis.DIDs).
+// Input descriptors that only accept a DiscoveryRegistrationCredential are skipped,
+// since the Nuts node issues that credential itself when registering.
+func AnalyzeRegistration(ctx context.Context, client ClientInterface, vcrClient vcr.ClientInterface, serviceID string, subjectID string) (*RegistrationAnalysis, error) {
+	service, err := GetService(ctx, client, serviceID)
+	if err != nil {
+		return nil, err
+	}
+	definition, err := pe.ParsePresentationDefinition(service.PresentationDefinition)
+	if err != nil {
+		return nil, err
+	}
+	definition.InputDescriptors = slices.DeleteFunc(definition.InputDescriptors, func(descriptor pe.InputDescriptor) bool {
+		return slices.Equal(missingCredential(pe.MissingInputDescriptor{InputDescriptor: descriptor}).CredentialTypes, []string{"DiscoveryRegistrationCredential"})
+	})
+	httpResponse, err := vcrClient.GetCredentialsInWallet(ctx, subjectID)
+	response, err := nuts.ParseResponse(err, httpResponse, vcr.ParseGetCredentialsInWalletResponse)
+	if err != nil {
+		return nil, fmt.Errorf("list wallet credentials: %w", err)
+	}
+	if response.JSON200 == nil {
+		return nil, fmt.Errorf("failed list wallet credentials response: %s", response.Status())
+	}
+	credentialsByDID := make(map[string][]vc.VerifiableCredential)
+	for _, credential := range *response.JSON200 {
+		// Credentials without a subject DID can't be presented by any DID of the subject
+		if subjectDID, err := credential.SubjectDID(); err == nil {
+			credentialsByDID[subjectDID.String()] = append(credentialsByDID[subjectDID.String()], credential)
+		}
+	}
+	result := RegistrationAnalysis{
+		ServiceID: serviceID,
+		SubjectID: subjectID,
+	}
+	for _, id := range nuts.SortedKeys(credentialsByDID) {
+		analysis, err := analyzeCredentials(*definition, credentialsByDID[id])
+		if err != nil {
+			return nil, fmt.Errorf("discovery service %s: %w", serviceID, err)
+		}
+		analysis.DID = id
+		result.DIDs = append(result.DIDs, *analysis)
+	}
+	if len(result.DIDs) == 0 {
+		analysis, err := analyzeCredentials(*definition, nil)
+		if err != nil {
+			return nil, fmt.Errorf("discovery service %s: %w", serviceID, err)
+		}
+		result.Missing = analysis.Missing
+		return &result, nil
+	}
+	for _, analysis := range result.DIDs {
+		if analysis.Satisfied {
+			result.Satisfied = true
+			result.Missing = nil
+			break
+		}
+		if result.Missing == nil || len(analysis.Missing) < len(result.Missing) {
+			result.Missing = analysis.Missing
+		}
+	}
+	return &result, nil
+}
+
+func analyzeCredentials(definition pe.PresentationDefinition, credentials []vc.VerifiableCredential) (*DIDRegistrationAnalysis, error) {
+	match, err := definition.Match(credentials)
+	if err != nil {
+		return nil, err
+	}
+	result := DIDRegistrationAnalysis{Satisfied: match.Satisfied}
+	for _, missing := range match.Missing {
+		result.Missing = append(result.Missing, missingCredential(missing))
+	}
+	return &result, nil
+}
+
+func missingCredential(missing pe.MissingInputDescriptor) MissingCredential {
+	descriptor := missing.InputDescriptor
+	result := MissingCredential{
+		InputDescriptorID: descriptor.ID,
+		Name:              descriptor.Name,
+		Purpose:           descriptor.Purpose,
+		Reason:            missing.Reason,
+	}
+	for _, field := range descriptor.Constraints.Fields {
+		if field.Optional {
+			continue
+		}
+		if slices.Contains(field.Path, "$.type") || slices.Contains(field.Path, "$['type']") {
+			result.CredentialTypes = append(result.CredentialTypes, filterValues(field.Filter)...)
+			continue
+		}
+		if field.ID != "" {
+			result.Fields = append(result.Fields, field.ID)
+		} else if len(field.Path) > 0 {
+			result.Fields = append(result.Fields, field.Path[0])
+		}
+	}
+	return result
+}
+
+// filterValues returns the string values a filter accepts through const, enum or contains.
+func filterValues(filter *pe.Filter) []string {
+	if filter == nil {
+		return nil
+	}
+	var result []string
+	if value, ok := filter.Const.(string); ok {
+		result = append(result, value)
+	}
+	for _, value := range filter.Enum {
+		if value, ok := value.(string); ok {
+			result = append(result, value)
+		}
+	}
+	return append(result, filterValues(filter.Contains)...)
+}
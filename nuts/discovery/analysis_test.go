@@ -0,0 +1,144 @@
+package discovery
+
+import (
+	"context"
+	"github.com/nuts-foundation/go-nuts-client/nuts/vcr"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestAnalyzeRegistration(t *testing.T) {
+	organizationCredential := func(holder string) string {
+		return `{
+  "@context": ["https://www.w3.org/2018/credentials/v1", "https://nuts.nl/credentials/v1"],
+  "type": ["VerifiableCredential", "NutsOrganizationCredential"],
+  "issuer": "did:web:example.com:iam:issuer",
+  "issuanceDate": "2024-01-01T00:00:00Z",
+  "credentialSubject": {"id": "` + holder + `", "organization": {"name": "Hospital", "city": "Amsterdam"}}
+}`
+	}
+	uraCredential := func(holder string) string {
+		return `{
+  "@context": ["https://www.w3.org/2018/credentials/v1", "https://nuts.nl/credentials/v1"],
+  "type": ["VerifiableCredential", "NutsUraCredential"],
+  "issuer": "did:web:example.com:iam:issuer",
+  "issuanceDate": "2024-01-01T00:00:00Z",
+  "credentialSubject": {"id": "` + holder + `", "organization": {"ura": "1234"}}
+}`
+	}
+	wallets := map[string][]string{
+		"holder":   {organizationCredential("did:web:example.com:iam:holder")},
+		"split":    {organizationCredential("did:web:example.com:iam:split"), uraCredential("did:nuts:split")},
+		"complete": {organizationCredential("did:web:example.com:iam:complete"), uraCredential("did:web:example.com:iam:complete"), organizationCredential("did:nuts:complete")},
+	}
+	handler := http.NewServeMux()
+	handler.HandleFunc("GET /internal/discovery/v1", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte(`[{
+  "id": "care",
+  "presentation_max_validity": 3600,
+  "presentation_definition": {
+    "id": "pd_care",
+    "input_descriptors": [
+      {
+        "id": "organization",
+        "constraints": {
+          "fields": [
+            {"path": ["$.type"], "filter": {"type": "string", "const": "NutsOrganizationCredential"}},
+            {"id": "organization_name", "path": ["$.credentialSubject.organization.name"]}
+          ]
+        }
+      },
+      {
+        "id": "ura",
+        "name": "URA",
+        "purpose": "Identifies the care organization",
+        "constraints": {
+          "fields": [
+            {"path": ["$.type"], "filter": {"type": "string", "enum": ["NutsUraCredential", "X509Credential"]}},
+            {"path": ["$.issuer"], "filter": {"type": "string", "pattern": "^did:web:"}},
+            {"id": "organization_ura", "path": ["$.credentialSubject.organization.ura"]},
+            {"id": "organization_phone", "path": ["$.credentialSubject.organization.phone"], "optional": true}
+          ]
+        }
+      },
+      {
+        "id": "registration",
+        "constraints": {
+          "fields": [
+            {"path": ["$.type"], "filter": {"type": "string", "const": "DiscoveryRegistrationCredential"}},
+            {"id": "fhir", "path": ["$.credentialSubject.fhir"]}
+          ]
+        }
+      }
+    ]
+  }
+}]`))
+	})
+	handler.HandleFunc("GET /internal/vcr/v2/holder/{subjectID}/vc", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte(`[` + strings.Join(wallets[r.PathValue("subjectID")], ",") + `]`))
+	})
+	httpServer := httptest.NewServer(handler)
+	client, _ := NewClient(httpServer.URL)
+	vcrClient, _ := vcr.NewClient(httpServer.URL)
+
+	t.Run("satisfied", func(t *testing.T) {
+		analysis, err := AnalyzeRegistration(context.Background(), client, vcrClient, "care", "complete")
+
+		require.NoError(t, err)
+		require.True(t, analysis.Satisfied)
+		require.Empty(t, analysis.Missing)
+		require.Len(t, analysis.DIDs, 2)
+		require.Equal(t, "did:nuts:complete", analysis.DIDs[0].DID)
+		require.False(t, analysis.DIDs[0].Satisfied)
+		require.Equal(t, "did:web:example.com:iam:complete", analysis.DIDs[1].DID)
+		require.True(t, analysis.DIDs[1].Satisfied)
+	})
+	t.Run("credentials of different DIDs", func(t *testing.T) {
+		analysis, err := AnalyzeRegistration(context.Background(), client, vcrClient, "care", "split")
+
+		require.NoError(t, err)
+		require.False(t, analysis.Satisfied)
+		require.Len(t, analysis.DIDs, 2)
+		require.Equal(t, "organization", analysis.DIDs[0].Missing[0].InputDescriptorID)
+		require.Equal(t, "ura", analysis.DIDs[1].Missing[0].InputDescriptorID)
+		require.Len(t, analysis.Missing, 1)
+	})
+	t.Run("missing credential", func(t *testing.T) {
+		analysis, err := AnalyzeRegistration(context.Background(), client, vcrClient, "care", "holder")
+
+		require.NoError(t, err)
+		require.False(t, analysis.Satisfied)
+		require.Len(t, analysis.DIDs, 1)
+		require.Equal(t, "did:web:example.com:iam:holder", analysis.DIDs[0].DID)
+		require.Equal(t, analysis.Missing, analysis.DIDs[0].Missing)
+		require.Equal(t, []MissingCredential{{
+			InputDescriptorID: "ura",
+			Name:              "URA",
+			Purpose:           "Identifies the care organization",
+			CredentialTypes:   []string{"NutsUraCredential", "X509Credential"},
+			Fields:            []string{"$.issuer", "organization_ura"},
+			Reason:            "field $.type does not match the filter",
+		}}, analysis.Missing)
+	})
+	t.Run("empty wallet", func(t *testing.T) {
+		analysis, err := AnalyzeRegistration(context.Background(), client, vcrClient, "care", "empty")
+
+		require.NoError(t, err)
+		require.Empty(t, analysis.DIDs)
+		require.Len(t, analysis.Missing, 2)
+		require.Equal(t, []string{"NutsOrganizationCredential"}, analysis.Missing[0].CredentialTypes)
+		require.Equal(t, "no credentials", analysis.Missing[0].Reason)
+	})
+	t.Run("unknown service", func(t *testing.T) {
+		_, err := AnalyzeRegistration(context.Background(), client, vcrClient, "other", "holder")
+
+		require.EqualError(t, err, "discovery service not found: other")
+	})
+}
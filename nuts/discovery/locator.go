@@ -0,0 +1,215 @@
+package discovery
+
+import (
+	"container/list"
+	"context"
+	"fmt"
+	"github.com/nuts-foundation/go-nuts-client/nuts"
+	"github.com/nuts-foundation/go-nuts-client/oauth2"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultLocatorCacheTTL is the duration an AuthorizationServerLocator caches located Authorization Servers if AuthorizationServerLocator.CacheTTL is not set.
+const DefaultLocatorCacheTTL = 5 * time.Minute
+
+// DefaultLocatorCacheMaxEntries is the maximum number of partner DIDs an AuthorizationServerLocator caches the Authorization Server of,
+// if AuthorizationServerLocator.CacheMaxEntries is not set.
+const DefaultLocatorCacheMaxEntries = 10000
+
+// WithPartnerDID returns a new context with the DID of the organization a request is sent to,
+// which is used by AuthorizationServerLocator to find the organization's registration on the Discovery Service.
+// It is equivalent to nuts.WithPartnerDID.
+func WithPartnerDID(ctx context.Context, did string) context.Context {
+	return nuts.WithPartnerDID(ctx, did)
+}
+
+// AuthorizationServerLocator locates the OAuth2 Authorization Server of a resource server through its registration on a Discovery Service,
+// for resource servers that don't advertise it in the WWW-Authenticate header or through protected resource metadata.
+// It uses the authServerURL registration parameter of the registration of:
+//   - the partner DID specified in the request context (see WithPartnerDID), or otherwise
+//   - the organization that registered an endpoint (registration parameter) on the host of the request.
+//
+// Located Authorization Servers of partner DIDs are cached; when the cache is full, the least recently used one is evicted.
+// Hosts are looked up in an index of all registrations on the Discovery Service, which is rebuilt when it expires.
+// Add its Locate method to oauth2.Transport.AuthzServerLocators. It must not be copied after first use.
+type AuthorizationServerLocator struct {
+	// Client is the client of the Discovery API of the Nuts node.
+	Client ClientInterface
+	// ServiceID is the ID of the Discovery Service to search.
+	ServiceID string
+	// Replica is optionally used to search a local replica of the Discovery Service, instead of the Nuts node.
+	Replica *Replica
+	// CacheTTL is the duration located Authorization Servers (or the absence thereof) and the host index are cached.
+	// If not set, DefaultLocatorCacheTTL is used. Nothing is cached while the Replica is stale.
+	CacheTTL time.Duration
+	// CacheMaxEntries is the maximum number of cached partner DIDs. If not set, DefaultLocatorCacheMaxEntries is used.
+	CacheMaxEntries int
+
+	mux     sync.Mutex
+	entries map[string]*list.Element
+	lru     *list.List
+	hosts   *hostIndex
+}
+
+type locatorCacheEntry struct {
+	did           string
+	authServerURL *url.URL
+	expiresAt     time.Time
+}
+
+// hostIndex maps (lower case) hosts to the Authorization Servers of the organizations that registered an endpoint on them.
+type hostIndex struct {
+	authServerURLs map[string][]string
+	expiresAt      time.Time
+}
+
+var _ oauth2.AuthorizationServerLocator = (&AuthorizationServerLocator{}).Locate
+
+// Locate returns the URL of the Authorization Server of the resource server that sent the response, or nil if it isn't registered.
+func (l *AuthorizationServerLocator) Locate(_ *oauth2.MetadataLoader, response *http.Response) (*url.URL, error) {
+	ctx := response.Request.Context()
+	if did := nuts.PartnerDID(ctx); did != "" {
+		return l.locateByDID(ctx, did)
+	}
+	return l.locateByHost(ctx, strings.ToLower(response.Request.URL.Hostname()))
+}
+
+func (l *AuthorizationServerLocator) locateByDID(ctx context.Context, did string) (*url.URL, error) {
+	l.mux.Lock()
+	l.init()
+	if element, ok := l.entries[did]; ok {
+		entry := element.Value.(*locatorCacheEntry)
+		if time.Now().Before(entry.expiresAt) {
+			l.lru.MoveToFront(element)
+			l.mux.Unlock()
+			return entry.authServerURL, nil
+		}
+		l.remove(element)
+	}
+	l.mux.Unlock()
+	results, err := l.search(ctx, NewQuery().Equals("credentialSubject.id", did))
+	if err != nil {
+		return nil, err
+	}
+	var candidates []string
+	for _, result := range results {
+		if result.CredentialSubjectId == did {
+			candidates = appendAuthServerURL(candidates, result)
+		}
+	}
+	authServerURL, err := l.authServerURL(candidates, did)
+	if err != nil || l.stale() {
+		return authServerURL, err
+	}
+	l.mux.Lock()
+	defer l.mux.Unlock()
+	l.add(&locatorCacheEntry{did: did, authServerURL: authServerURL, expiresAt: time.Now().Add(l.cacheTTL())})
+	return authServerURL, nil
+}
+
+func (l *AuthorizationServerLocator) locateByHost(ctx context.Context, host string) (*url.URL, error) {
+	l.mux.Lock()
+	index := l.hosts
+	l.mux.Unlock()
+	if index == nil || !time.Now().Before(index.expiresAt) {
+		// Registrations on a host can't be queried, since the registration parameters aren't searchable
+		results, err := l.search(ctx, NewQuery())
+		if err != nil {
+			return nil, err
+		}
+		index = newHostIndex(results, time.Now().Add(l.cacheTTL()))
+		if !l.stale() {
+			l.mux.Lock()
+			l.hosts = index
+			l.mux.Unlock()
+		}
+	}
+	return l.authServerURL(index.authServerURLs[host], host)
+}
+
+func (l *AuthorizationServerLocator) search(ctx context.Context, query Query) ([]SearchResult, error) {
+	if l.Replica != nil {
+		return l.Replica.Search(query)
+	}
+	return Search(ctx, l.Client, l.ServiceID, query)
+}
+
+// stale reports whether the Replica isn't (or no longer) up-to-date, e.g. because it wasn't refreshed yet, so its results must not be cached.
+func (l *AuthorizationServerLocator) stale() bool {
+	return l.Replica != nil && l.Replica.Stale()
+}
+
+// authServerURL returns the Authorization Server registered for the partner DID or host, or nil if there is none.
+func (l *AuthorizationServerLocator) authServerURL(candidates []string, registeredFor string) (*url.URL, error) {
+	switch len(candidates) {
+	case 0:
+		return nil, nil
+	case 1:
+		return url.Parse(candidates[0])
+	default:
+		return nil, fmt.Errorf("multiple Authorization Servers registered on discovery service %s for %s", l.ServiceID, registeredFor)
+	}
+}
+
+func newHostIndex(results []SearchResult, expiresAt time.Time) *hostIndex {
+	index := &hostIndex{authServerURLs: make(map[string][]string), expiresAt: expiresAt}
+	for _, result := range results {
+		for name, value := range result.RegistrationParameters {
+			endpoint, ok := value.(string)
+			if !ok || name == "authServerURL" || !isURL(endpoint) {
+				continue
+			}
+			u, _ := url.Parse(endpoint)
+			host := strings.ToLower(u.Hostname())
+			index.authServerURLs[host] = appendAuthServerURL(index.authServerURLs[host], result)
+		}
+	}
+	return index
+}
+
+// appendAuthServerURL appends the Authorization Server of the registration, if it has one that isn't in the list yet.
+func appendAuthServerURL(authServerURLs []string, result SearchResult) []string {
+	authServerURL, _ := result.RegistrationParameters["authServerURL"].(string)
+	if authServerURL == "" || slices.Contains(authServerURLs, authServerURL) {
+		return authServerURLs
+	}
+	return append(authServerURLs, authServerURL)
+}
+
+func (l *AuthorizationServerLocator) add(entry *locatorCacheEntry) {
+	if element, ok := l.entries[entry.did]; ok {
+		l.remove(element)
+	}
+	maxEntries := l.CacheMaxEntries
+	if maxEntries <= 0 {
+		maxEntries = DefaultLocatorCacheMaxEntries
+	}
+	for l.lru.Len() >= maxEntries {
+		l.remove(l.lru.Back())
+	}
+	l.entries[entry.did] = l.lru.PushFront(entry)
+}
+
+func (l *AuthorizationServerLocator) remove(element *list.Element) {
+	l.lru.Remove(element)
+	delete(l.entries, element.Value.(*locatorCacheEntry).did)
+}
+
+func (l *AuthorizationServerLocator) init() {
+	if l.entries == nil {
+		l.entries = make(map[string]*list.Element)
+		l.lru = list.New()
+	}
+}
+
+func (l *AuthorizationServerLocator) cacheTTL() time.Duration {
+	if l.CacheTTL <= 0 {
+		return DefaultLocatorCacheTTL
+	}
+	return l.CacheTTL
+}
@@ -0,0 +1,127 @@
+package discovery
+
+import (
+	"context"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+)
+
+func TestAuthorizationServerLocator_Locate(t *testing.T) {
+	var searches atomic.Int32
+	var lastQuery atomic.Value
+	handler := http.NewServeMux()
+	handler.HandleFunc("GET /internal/discovery/v1/{serviceID}", func(w http.ResponseWriter, r *http.Request) {
+		searches.Add(1)
+		lastQuery.Store(r.URL.RawQuery)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte(`[
+  {
+    "id": "did:web:a#1",
+    "credential_subject_id": "did:web:a",
+    "registrationParameters": {"authServerURL": "https://a.example.com/oauth2/a", "fhirBaseURL": "https://fhir.a.example.com/fhir"},
+    "vp": "eyJhbGciOiJFUzI1NiJ9.eyJ2cCI6e319.c2lnbmF0dXJl"
+  },
+  {
+    "id": "did:web:b#1",
+    "credential_subject_id": "did:web:b",
+    "registrationParameters": {"authServerURL": "https://b.example.com/oauth2/b", "fhirBaseURL": "https://shared.example.com/b"},
+    "vp": "eyJhbGciOiJFUzI1NiJ9.eyJ2cCI6e319.c2lnbmF0dXJl"
+  },
+  {
+    "id": "did:web:c#1",
+    "credential_subject_id": "did:web:c",
+    "registrationParameters": {"authServerURL": "https://c.example.com/oauth2/c", "fhirBaseURL": "https://shared.example.com/c"},
+    "vp": "eyJhbGciOiJFUzI1NiJ9.eyJ2cCI6e319.c2lnbmF0dXJl"
+  }
+]`))
+	})
+	httpServer := httptest.NewServer(handler)
+	client, _ := NewClient(httpServer.URL)
+	responseTo := func(ctx context.Context, requestURL string) *http.Response {
+		return &http.Response{Request: httptest.NewRequest(http.MethodGet, requestURL, nil).WithContext(ctx)}
+	}
+
+	t.Run("by host", func(t *testing.T) {
+		locator := &AuthorizationServerLocator{Client: client, ServiceID: "care"}
+		searches.Store(0)
+
+		authServerURL, err := locator.Locate(nil, responseTo(context.Background(), "https://FHIR.a.example.com/fhir/Patient"))
+
+		require.NoError(t, err)
+		require.Equal(t, "https://a.example.com/oauth2/a", authServerURL.String())
+		t.Run("cached", func(t *testing.T) {
+			authServerURL, err := locator.Locate(nil, responseTo(context.Background(), "https://fhir.a.example.com/fhir/Observation"))
+
+			require.NoError(t, err)
+			require.Equal(t, "https://a.example.com/oauth2/a", authServerURL.String())
+			require.Equal(t, int32(1), searches.Load())
+		})
+		t.Run("other host is located from the same index", func(t *testing.T) {
+			_, err := locator.Locate(nil, responseTo(context.Background(), "https://other.example.com/fhir"))
+
+			require.NoError(t, err)
+			require.Equal(t, int32(1), searches.Load())
+		})
+	})
+	t.Run("by partner DID", func(t *testing.T) {
+		locator := &AuthorizationServerLocator{Client: client, ServiceID: "care"}
+		ctx := WithPartnerDID(context.Background(), "did:web:c")
+
+		authServerURL, err := locator.Locate(nil, responseTo(ctx, "https://shared.example.com/c/Patient"))
+
+		require.NoError(t, err)
+		require.Equal(t, "https://c.example.com/oauth2/c", authServerURL.String())
+		require.Equal(t, "credentialSubject.id=did%3Aweb%3Ac", lastQuery.Load())
+	})
+	t.Run("least recently used partner DID is evicted", func(t *testing.T) {
+		locator := &AuthorizationServerLocator{Client: client, ServiceID: "care", CacheMaxEntries: 1}
+		searches.Store(0)
+		locate := func(did string) {
+			_, err := locator.Locate(nil, responseTo(WithPartnerDID(context.Background(), did), "https://shared.example.com/Patient"))
+			require.NoError(t, err)
+		}
+		locate("did:web:a")
+		locate("did:web:a")
+		locate("did:web:b")
+
+		locate("did:web:a")
+
+		require.Equal(t, int32(3), searches.Load())
+		require.Len(t, locator.entries, 1)
+	})
+	t.Run("host shared by multiple organizations", func(t *testing.T) {
+		locator := &AuthorizationServerLocator{Client: client, ServiceID: "care"}
+
+		_, err := locator.Locate(nil, responseTo(context.Background(), "https://shared.example.com/c/Patient"))
+
+		require.EqualError(t, err, "multiple Authorization Servers registered on discovery service care for shared.example.com")
+	})
+	t.Run("not registered", func(t *testing.T) {
+		locator := &AuthorizationServerLocator{Client: client, ServiceID: "care"}
+		searches.Store(0)
+
+		authServerURL, err := locator.Locate(nil, responseTo(context.Background(), "https://other.example.com/fhir"))
+		require.NoError(t, err)
+		require.Nil(t, authServerURL)
+		_, _ = locator.Locate(nil, responseTo(context.Background(), "https://other.example.com/fhir"))
+
+		require.Equal(t, int32(1), searches.Load())
+	})
+	t.Run("stale replica", func(t *testing.T) {
+		replica := &Replica{Client: client, ServiceID: "care"}
+		locator := &AuthorizationServerLocator{Client: client, ServiceID: "care", Replica: replica}
+
+		authServerURL, err := locator.Locate(nil, responseTo(context.Background(), "https://fhir.a.example.com/fhir"))
+		require.NoError(t, err)
+		require.Nil(t, authServerURL)
+		require.NoError(t, replica.Refresh(context.Background()))
+		authServerURL, err = locator.Locate(nil, responseTo(context.Background(), "https://fhir.a.example.com/fhir"))
+
+		require.NoError(t, err)
+		require.Equal(t, "https://a.example.com/oauth2/a", authServerURL.String())
+	})
+}
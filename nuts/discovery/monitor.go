@@ -0,0 +1,269 @@
+package discovery
+
+import (
+	"context"
+	"fmt"
+	"github.com/nuts-foundation/go-did/vc"
+	"github.com/nuts-foundation/go-nuts-client/nuts"
+	"github.com/nuts-foundation/go-nuts-client/nuts/vdr"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultMonitorInterval is the interval at which an ActivationMonitor checks the activations if ActivationMonitor.Interval is not set.
+const DefaultMonitorInterval = 5 * time.Minute
+
+// ActivationMonitor periodically checks whether subjects are actually registered on the Discovery Services they're activated on:
+// a Discovery Service can be activated for a subject, while none (or not all) of its DIDs are registered,
+// e.g. because the Discovery Server is unreachable or rejects the presentation.
+// It must not be copied after first use.
+type ActivationMonitor struct {
+	// Client is the client of the Discovery API of the Nuts node.
+	Client ClientInterface
+	// VDRClient is the client of the VDR API of the Nuts node, used to list the DIDs of the subjects.
+	VDRClient vdr.ClientInterface
+	// Activations maps the IDs of the monitored subjects to the IDs of the Discovery Services they should be activated on.
+	Activations map[string][]string
+	// Interval is the interval at which the activations are checked. If not set, DefaultMonitorInterval is used.
+	Interval time.Duration
+	// ExpiryThreshold is the remaining validity under which a registered presentation is reported as expiring.
+	// If not set, a quarter of the Discovery Service's PresentationMaxValidity is used.
+	ExpiryThreshold time.Duration
+	// OnReport is optionally called with the report of every check.
+	OnReport func(report HealthReport)
+
+	mux    sync.Mutex
+	report *HealthReport
+}
+
+// HealthReport is the result of checking the activations of the monitored subjects.
+type HealthReport struct {
+	CheckedAt time.Time
+	// Activations contains the health of each monitored activation, ordered by subject and service.
+	Activations []ActivationHealth
+}
+
+// ActivationHealth is the health of the activation of a Discovery Service for a subject.
+type ActivationHealth struct {
+	SubjectID string
+	ServiceID string
+	// Activated indicates whether the Discovery Service is activated for the subject.
+	Activated bool
+	// Methods contains the registration status of the subject's DIDs, per DID method (ordered by method).
+	Methods []MethodRegistration
+	// Err contains the error that occurred while checking the activation.
+	Err error
+}
+
+// MethodRegistration is the registration status of the DIDs of a subject with a specific DID method (e.g. web).
+type MethodRegistration struct {
+	Method string
+	// DIDs contains the subject's DIDs with this method.
+	DIDs []string
+	// Registered indicates whether a presentation of one of the DIDs is registered on the Discovery Service.
+	Registered bool
+	// ExpiresAt is the expiry time of the registered presentation, if known.
+	ExpiresAt *time.Time
+	// Expiring indicates the registered presentation expires within the expiry threshold (or already expired).
+	// The Nuts node should have refreshed it by then.
+	Expiring bool
+}
+
+// Healthy reports whether all monitored activations are healthy.
+func (r HealthReport) Healthy() bool {
+	for _, activation := range r.Activations {
+		if !activation.Healthy() {
+			return false
+		}
+	}
+	return true
+}
+
+// Healthy reports whether the Discovery Service is activated for the subject, and all its DID methods have a registered
+// presentation that isn't about to expire.
+func (h ActivationHealth) Healthy() bool {
+	if h.Err != nil || !h.Activated || len(h.Methods) == 0 {
+		return false
+	}
+	for _, method := range h.Methods {
+		if !method.Registered || method.Expiring {
+			return false
+		}
+	}
+	return true
+}
+
+// Run checks the activations at the configured interval until the context is cancelled.
+func (m *ActivationMonitor) Run(ctx context.Context) {
+	interval := m.Interval
+	if interval <= 0 {
+		interval = DefaultMonitorInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		m.Check(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Report returns the report of the last check, or nil if the activations haven't been checked yet.
+func (m *ActivationMonitor) Report() *HealthReport {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+	return m.report
+}
+
+// Check checks the activations of the monitored subjects, stores the report and passes it to OnReport.
+func (m *ActivationMonitor) Check(ctx context.Context) HealthReport {
+	report := HealthReport{CheckedAt: time.Now()}
+	services, servicesErr := m.services(ctx)
+	for _, subjectID := range nuts.SortedKeys(m.Activations) {
+		serviceIDs := slices.Clone(m.Activations[subjectID])
+		slices.Sort(serviceIDs)
+		dids, didsErr := vdr.SubjectDIDs(ctx, m.VDRClient, subjectID)
+		for _, serviceID := range serviceIDs {
+			health := ActivationHealth{SubjectID: subjectID, ServiceID: serviceID}
+			switch {
+			case servicesErr != nil:
+				health.Err = servicesErr
+			case didsErr != nil:
+				health.Err = didsErr
+			default:
+				if service, ok := services[serviceID]; !ok {
+					health.Err = fmt.Errorf("discovery service not found: %s", serviceID)
+				} else {
+					health.Err = m.checkActivation(ctx, &health, service, dids)
+				}
+			}
+			report.Activations = append(report.Activations, health)
+		}
+	}
+	m.mux.Lock()
+	m.report = &report
+	m.mux.Unlock()
+	if m.OnReport != nil {
+		m.OnReport(report)
+	}
+	return report
+}
+
+func (m *ActivationMonitor) checkActivation(ctx context.Context, health *ActivationHealth, service ServiceDefinition, dids []string) error {
+	httpResponse, err := m.Client.GetServiceActivation(ctx, service.Id, health.SubjectID)
+	response, err := nuts.ParseResponse(err, httpResponse, ParseGetServiceActivationResponse)
+	if err != nil {
+		return fmt.Errorf("get activation: %w", err)
+	}
+	if response.JSON200 == nil {
+		return fmt.Errorf("failed get activation response: %s", response.Status())
+	}
+	health.Activated = response.JSON200.Activated
+	var presentations []vc.VerifiablePresentation
+	if response.JSON200.Vp != nil {
+		presentations = *response.JSON200.Vp
+	}
+	maxValidity := time.Duration(service.PresentationMaxValidity) * time.Second
+	threshold := m.ExpiryThreshold
+	if threshold <= 0 {
+		threshold = maxValidity / 4
+	}
+	methods := make(map[string]*MethodRegistration)
+	for _, did := range dids {
+		method := didMethod(did)
+		if methods[method] == nil {
+			methods[method] = &MethodRegistration{Method: method}
+		}
+		methods[method].DIDs = append(methods[method].DIDs, did)
+	}
+	for _, presentation := range presentations {
+		registration := methods[didMethod(presentationHolder(presentation))]
+		if registration == nil {
+			continue
+		}
+		registration.Registered = true
+		if expiresAt, ok := presentationExpiry(presentation, maxValidity); ok {
+			registration.ExpiresAt = &expiresAt
+			registration.Expiring = time.Until(expiresAt) < threshold
+		}
+	}
+	for _, method := range nuts.SortedKeys(methods) {
+		health.Methods = append(health.Methods, *methods[method])
+	}
+	return nil
+}
+
+func (m *ActivationMonitor) services(ctx context.Context) (map[string]ServiceDefinition, error) {
+	httpResponse, err := m.Client.GetServices(ctx)
+	response, err := nuts.ParseResponse(err, httpResponse, ParseGetServicesResponse)
+	if err != nil {
+		return nil, fmt.Errorf("list discovery services: %w", err)
+	}
+	if response.JSON200 == nil {
+		return nil, fmt.Errorf("failed list discovery services response: %s", response.Status())
+	}
+	result := make(map[string]ServiceDefinition)
+	for _, service := range *response.JSON200 {
+		result[service.Id] = service
+	}
+	return result, nil
+}
+
+// presentationHolder returns the DID of the holder of the presentation,
+// falling back to the subject of its first credential if the holder isn't specified.
+func presentationHolder(presentation vc.VerifiablePresentation) string {
+	if presentation.Holder != nil {
+		return presentation.Holder.String()
+	}
+	for _, credential := range presentation.VerifiableCredential {
+		var subjects []struct {
+			ID string `json:"id"`
+		}
+		if err := credential.UnmarshalCredentialSubject(&subjects); err == nil && len(subjects) > 0 {
+			return subjects[0].ID
+		}
+	}
+	return ""
+}
+
+// presentationExpiry returns the expiry time of the presentation: the exp claim of a JWT presentation, or the expires property
+// of the proof of a JSON-LD presentation. If not specified, the issuance time plus the maximum validity is assumed.
+func presentationExpiry(presentation vc.VerifiablePresentation, maxValidity time.Duration) (time.Time, bool) {
+	if token := presentation.JWT(); token != nil {
+		if !token.Expiration().IsZero() {
+			return token.Expiration(), true
+		}
+		if !token.IssuedAt().IsZero() {
+			return token.IssuedAt().Add(maxValidity), true
+		}
+		return time.Time{}, false
+	}
+	var proofs []struct {
+		Created *time.Time `json:"created"`
+		Expires *time.Time `json:"expires"`
+	}
+	if err := presentation.UnmarshalProofValue(&proofs); err != nil || len(proofs) == 0 {
+		return time.Time{}, false
+	}
+	if proofs[0].Expires != nil {
+		return *proofs[0].Expires, true
+	}
+	if proofs[0].Created != nil {
+		return proofs[0].Created.Add(maxValidity), true
+	}
+	return time.Time{}, false
+}
+
+// didMethod returns the method of the DID, e.g. web for did:web:example.com.
+func didMethod(did string) string {
+	parts := strings.SplitN(did, ":", 3)
+	if len(parts) < 3 || parts[0] != "did" {
+		return ""
+	}
+	return parts[1]
+}
@@ -0,0 +1,129 @@
+package discovery
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"github.com/nuts-foundation/go-nuts-client/nuts/vdr"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// createJWTPresentation returns an (unsigned) JWT presentation of the holder, which expires at the given time.
+func createJWTPresentation(t *testing.T, holder string, expiresAt time.Time) string {
+	payload, err := json.Marshal(map[string]interface{}{
+		"iss": holder,
+		"exp": expiresAt.Unix(),
+		"vp": map[string]interface{}{
+			"@context": []string{"https://www.w3.org/2018/credentials/v1"},
+			"type":     "VerifiablePresentation",
+		},
+	})
+	require.NoError(t, err)
+	return base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"ES256"}`)) + "." + base64.RawURLEncoding.EncodeToString(payload) + ".c2lnbmF0dXJl"
+}
+
+func TestActivationMonitor_Check(t *testing.T) {
+	now := time.Now()
+	activations := map[string]string{
+		"care/a": `{"activated": true, "vp": ["` + createJWTPresentation(t, "did:web:a", now.Add(3*time.Hour)) + `"]}`,
+		"care/b": `{"activated": true, "vp": [{
+			"@context": ["https://www.w3.org/2018/credentials/v1"],
+			"type": "VerifiablePresentation",
+			"holder": "did:web:b",
+			"proof": {"type": "JsonWebSignature2020", "created": "` + now.Add(-3*time.Hour-30*time.Minute).Format(time.RFC3339) + `"}
+		}]}`,
+		"billing/b": `{"activated": true, "vp": []}`,
+	}
+	handler := http.NewServeMux()
+	handler.HandleFunc("GET /internal/discovery/v1", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte(`[{"id": "care", "presentation_definition": {}, "presentation_max_validity": 14400}, {"id": "billing", "presentation_definition": {}, "presentation_max_validity": 14400}]`))
+	})
+	handler.HandleFunc("GET /internal/discovery/v1/{serviceID}/{subjectID}", func(w http.ResponseWriter, r *http.Request) {
+		response, ok := activations[r.PathValue("serviceID")+"/"+r.PathValue("subjectID")]
+		if !ok {
+			response = `{"activated": false}`
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte(response))
+	})
+	handler.HandleFunc("GET /internal/vdr/v2/subject/{id}", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		switch r.PathValue("id") {
+		case "a":
+			_, _ = w.Write([]byte(`["did:web:a", "did:nuts:a"]`))
+		default:
+			_, _ = w.Write([]byte(`["did:web:b"]`))
+		}
+	})
+	httpServer := httptest.NewServer(handler)
+	client, _ := NewClient(httpServer.URL)
+	vdrClient, _ := vdr.NewClient(httpServer.URL)
+	var callbackReport *HealthReport
+	monitor := &ActivationMonitor{
+		Client:    client,
+		VDRClient: vdrClient,
+		Activations: map[string][]string{
+			"a": {"care"},
+			"b": {"care", "billing", "other"},
+		},
+		OnReport: func(report HealthReport) {
+			callbackReport = &report
+		},
+	}
+
+	report := monitor.Check(context.Background())
+
+	require.False(t, report.Healthy())
+	require.Equal(t, &report, callbackReport)
+	require.Equal(t, &report, monitor.Report())
+	require.Len(t, report.Activations, 4)
+	t.Run("DID method not registered", func(t *testing.T) {
+		health := report.Activations[0]
+		require.Equal(t, "a", health.SubjectID)
+		require.Equal(t, "care", health.ServiceID)
+		require.True(t, health.Activated)
+		require.False(t, health.Healthy())
+		require.Len(t, health.Methods, 2)
+		require.Equal(t, MethodRegistration{Method: "nuts", DIDs: []string{"did:nuts:a"}}, health.Methods[0])
+		require.Equal(t, "web", health.Methods[1].Method)
+		require.True(t, health.Methods[1].Registered)
+		require.False(t, health.Methods[1].Expiring)
+		require.Equal(t, now.Add(3*time.Hour).Unix(), health.Methods[1].ExpiresAt.Unix())
+	})
+	t.Run("activated without presentations", func(t *testing.T) {
+		health := report.Activations[1]
+		require.Equal(t, "billing", health.ServiceID)
+		require.True(t, health.Activated)
+		require.False(t, health.Methods[0].Registered)
+		require.False(t, health.Healthy())
+	})
+	t.Run("presentation is expiring", func(t *testing.T) {
+		health := report.Activations[2]
+		require.Equal(t, "care", health.ServiceID)
+		require.True(t, health.Methods[0].Registered)
+		require.True(t, health.Methods[0].Expiring)
+		require.False(t, health.Healthy())
+
+		monitor.ExpiryThreshold = 10 * time.Minute
+		health = monitor.Check(context.Background()).Activations[2]
+		require.False(t, health.Methods[0].Expiring)
+		require.True(t, health.Healthy())
+	})
+	t.Run("unknown service", func(t *testing.T) {
+		require.EqualError(t, report.Activations[3].Err, "discovery service not found: other")
+	})
+}
+
+func Test_didMethod(t *testing.T) {
+	require.Equal(t, "web", didMethod("did:web:example.com:iam:1"))
+	require.Equal(t, "", didMethod("did:web"))
+	require.Equal(t, "", didMethod("urn:web:example.com"))
+}
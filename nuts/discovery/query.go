@@ -0,0 +1,177 @@
+package discovery
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/nuts-foundation/go-nuts-client/nuts"
+	"github.com/nuts-foundation/go-nuts-client/nuts/pe"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Query is a search query for the presentations of a Discovery Service.
+// It matches (nested) fields of the credentials in the presentations, specified in dot notation (e.g. credentialSubject.organization.name).
+// Query is immutable: its methods return a copy with the added criterion, e.g.:
+//
+//	NewQuery().Equals("credentialSubject.organization.city", "Amsterdam").HasPrefix("credentialSubject.organization.name", "Hospital")
+type Query struct {
+	criteria map[string]string
+	errs     []error
+}
+
+// NewQuery returns an empty Query, which matches all presentations.
+func NewQuery() Query {
+	return Query{}
+}
+
+// Equals returns a copy of the query that requires the field to be equal to the value.
+func (q Query) Equals(path string, value string) Query {
+	if strings.Contains(value, "*") {
+		return q.withError(fmt.Errorf("query value for %s can't contain a wildcard (*), use HasPrefix or Exists", path))
+	}
+	return q.with(path, value)
+}
+
+// HasPrefix returns a copy of the query that requires the field to start with the prefix.
+func (q Query) HasPrefix(path string, prefix string) Query {
+	if strings.Contains(prefix, "*") {
+		return q.withError(fmt.Errorf("query prefix for %s can't contain a wildcard (*)", path))
+	}
+	return q.with(path, prefix+"*")
+}
+
+// Exists returns a copy of the query that requires the field to be present (with any, non-empty value).
+func (q Query) Exists(path string) Query {
+	return q.with(path, "*")
+}
+
+// Paths returns the paths of the fields the query matches, in alphabetical order.
+func (q Query) Paths() []string {
+	result := make([]string, 0, len(q.criteria))
+	for path := range q.criteria {
+		result = append(result, path)
+	}
+	sort.Strings(result)
+	return result
+}
+
+// Params returns the query as parameters for SearchPresentations. It returns an error if the query is invalid.
+func (q Query) Params() (*SearchPresentationsParams, error) {
+	if len(q.errs) > 0 {
+		return nil, fmt.Errorf("invalid query: %w", errors.Join(q.errs...))
+	}
+	query := make(map[string]interface{}, len(q.criteria))
+	for path, value := range q.criteria {
+		query[path] = value
+	}
+	return &SearchPresentationsParams{Query: &query}, nil
+}
+
+// Validate checks that the fields the query matches are specified by the presentation definition of the Discovery Service,
+// since other fields can't be expected to be present in its presentations.
+func (q Query) Validate(service ServiceDefinition) error {
+	definition, err := pe.ParsePresentationDefinition(service.PresentationDefinition)
+	if err != nil {
+		return err
+	}
+	supported := make(map[string]bool)
+	for _, descriptor := range definition.InputDescriptors {
+		for _, field := range descriptor.Constraints.Fields {
+			for _, path := range field.Path {
+				supported[dotNotation(path)] = true
+			}
+		}
+	}
+	var errs []error
+	for _, path := range q.Paths() {
+		if !supported[path] {
+			errs = append(errs, fmt.Errorf("field %s is not in the presentation definition of service %s", path, service.Id))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (q Query) with(path string, value string) Query {
+	if path == "" || strings.HasPrefix(path, "$") || strings.ContainsAny(path, "[]* ") {
+		return q.withError(fmt.Errorf("invalid query path: %s", path))
+	}
+	criteria := make(map[string]string, len(q.criteria)+1)
+	for curr, value := range q.criteria {
+		criteria[curr] = value
+	}
+	criteria[path] = value
+	q.criteria = criteria
+	return q
+}
+
+func (q Query) withError(err error) Query {
+	q.errs = append(append([]error{}, q.errs...), err)
+	return q
+}
+
+var bracketMemberPattern = regexp.MustCompile(`\['([^']*)']`)
+
+// dotNotation converts a JSONPath expression of a presentation definition (e.g. $.credentialSubject['organization'].name)
+// to the dot notation used by queries (credentialSubject.organization.name).
+func dotNotation(jsonPath string) string {
+	result := bracketMemberPattern.ReplaceAllString(jsonPath, ".$1")
+	return strings.TrimPrefix(strings.TrimPrefix(result, "$"), ".")
+}
+
+// Search returns the presentations of the Discovery Service that match the query.
+func Search(ctx context.Context, client ClientInterface, serviceID string, query Query) ([]SearchResult, error) {
+	params, err := query.Params()
+	if err != nil {
+		return nil, err
+	}
+	httpResponse, err := client.SearchPresentations(ctx, serviceID, params)
+	response, err := nuts.ParseResponse(err, httpResponse, ParseSearchPresentationsResponse)
+	if err != nil {
+		return nil, fmt.Errorf("discovery search: %w", err)
+	}
+	if response.JSON200 == nil {
+		return nil, fmt.Errorf("failed discovery search response: %s", response.Status())
+	}
+	return *response.JSON200, nil
+}
+
+// GetService returns the definition of the Discovery Service with the given ID.
+func GetService(ctx context.Context, client ClientInterface, serviceID string) (*ServiceDefinition, error) {
+	httpResponse, err := client.GetServices(ctx)
+	response, err := nuts.ParseResponse(err, httpResponse, ParseGetServicesResponse)
+	if err != nil {
+		return nil, fmt.Errorf("list discovery services: %w", err)
+	}
+	if response.JSON200 == nil {
+		return nil, fmt.Errorf("failed list discovery services response: %s", response.Status())
+	}
+	for _, service := range *response.JSON200 {
+		if service.Id == serviceID {
+			return &service, nil
+		}
+	}
+	return nil, fmt.Errorf("discovery service not found: %s", serviceID)
+}
+
+// DecodeFields decodes the fields of the search result (input descriptor field IDs and their values) into the target,
+// e.g. a struct with JSON tags that match the field IDs.
+func (r SearchResult) DecodeFields(target interface{}) error {
+	return decode(r.Fields, target)
+}
+
+// DecodeRegistrationParameters decodes the registration parameters of the search result into the target,
+// e.g. a struct with JSON tags that match the parameter names (authServerURL is always present).
+func (r SearchResult) DecodeRegistrationParameters(target interface{}) error {
+	return decode(r.RegistrationParameters, target)
+}
+
+func decode(source map[string]interface{}, target interface{}) error {
+	data, err := json.Marshal(source)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, target)
+}
@@ -0,0 +1,163 @@
+package discovery
+
+import (
+	"context"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+const servicesResponse = `[
+  {
+    "id": "care",
+    "endpoint": "https://discovery.example.com/care",
+    "presentation_max_validity": 3600,
+    "presentation_definition": {
+      "id": "pd_care",
+      "input_descriptors": [
+        {
+          "id": "organization",
+          "constraints": {
+            "fields": [
+              {"path": ["$.type"], "filter": {"type": "string", "const": "NutsOrganizationCredential"}},
+              {"id": "organization_name", "path": ["$.credentialSubject.organization.name"]},
+              {"id": "organization_city", "path": ["$['credentialSubject']['organization']['city']"]}
+            ]
+          }
+        }
+      ]
+    }
+  }
+]`
+
+const searchResponse = `[
+  {
+    "id": "did:web:example.com:iam:holder#1",
+    "credential_subject_id": "did:web:example.com:iam:holder",
+    "fields": {"organization_name": "Hospital", "organization_city": "Amsterdam"},
+    "registrationParameters": {"authServerURL": "https://example.com/oauth2/holder", "fhirBaseURL": "https://example.com/fhir"},
+    "vp": "eyJhbGciOiJFUzI1NiJ9.eyJ2cCI6e319.c2lnbmF0dXJl"
+  }
+]`
+
+func TestQuery(t *testing.T) {
+	t.Run("params", func(t *testing.T) {
+		query := NewQuery().
+			Equals("credentialSubject.organization.city", "Amsterdam").
+			HasPrefix("credentialSubject.organization.name", "Hosp").
+			Exists("credentialSubject.organization.ura")
+
+		params, err := query.Params()
+
+		require.NoError(t, err)
+		require.Equal(t, map[string]interface{}{
+			"credentialSubject.organization.city": "Amsterdam",
+			"credentialSubject.organization.name": "Hosp*",
+			"credentialSubject.organization.ura":  "*",
+		}, *params.Query)
+	})
+	t.Run("immutable", func(t *testing.T) {
+		base := NewQuery().Equals("credentialSubject.organization.city", "Amsterdam")
+
+		_ = base.Equals("credentialSubject.organization.name", "Hospital")
+
+		require.Equal(t, []string{"credentialSubject.organization.city"}, base.Paths())
+	})
+	t.Run("invalid", func(t *testing.T) {
+		query := NewQuery().
+			Equals("credentialSubject.organization.city", "Amster*").
+			HasPrefix("$.credentialSubject.organization.name", "Hosp")
+
+		_, err := query.Params()
+
+		require.EqualError(t, err, "invalid query: query value for credentialSubject.organization.city can't contain a wildcard (*), use HasPrefix or Exists\ninvalid query path: $.credentialSubject.organization.name")
+	})
+}
+
+func TestQuery_Validate(t *testing.T) {
+	service := ServiceDefinition{
+		Id: "care",
+		PresentationDefinition: map[string]interface{}{
+			"input_descriptors": []interface{}{
+				map[string]interface{}{
+					"id": "organization",
+					"constraints": map[string]interface{}{
+						"fields": []interface{}{
+							map[string]interface{}{"path": []interface{}{"$.credentialSubject.organization.name"}},
+							map[string]interface{}{"path": []interface{}{"$['credentialSubject']['organization']['city']"}},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	t.Run("ok", func(t *testing.T) {
+		err := NewQuery().Equals("credentialSubject.organization.city", "Amsterdam").HasPrefix("credentialSubject.organization.name", "Hosp").Validate(service)
+
+		require.NoError(t, err)
+	})
+	t.Run("field not in presentation definition", func(t *testing.T) {
+		err := NewQuery().Equals("credentialSubject.organization.ura", "1234").Validate(service)
+
+		require.EqualError(t, err, "field credentialSubject.organization.ura is not in the presentation definition of service care")
+	})
+}
+
+func TestSearch(t *testing.T) {
+	var capturedQuery url.Values
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /internal/discovery/v1", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte(servicesResponse))
+	})
+	mux.HandleFunc("GET /internal/discovery/v1/care", func(w http.ResponseWriter, r *http.Request) {
+		capturedQuery = r.URL.Query()
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte(searchResponse))
+	})
+	httpServer := httptest.NewServer(mux)
+	client, _ := NewClient(httpServer.URL)
+	ctx := context.Background()
+
+	t.Run("ok", func(t *testing.T) {
+		service, err := GetService(ctx, client, "care")
+		require.NoError(t, err)
+		query := NewQuery().HasPrefix("credentialSubject.organization.name", "Hosp")
+		require.NoError(t, query.Validate(*service))
+
+		results, err := Search(ctx, client, "care", query)
+
+		require.NoError(t, err)
+		require.Equal(t, "Hosp*", capturedQuery.Get("credentialSubject.organization.name"))
+		require.Len(t, results, 1)
+		var fields struct {
+			Name string `json:"organization_name"`
+			City string `json:"organization_city"`
+		}
+		require.NoError(t, results[0].DecodeFields(&fields))
+		require.Equal(t, "Hospital", fields.Name)
+		require.Equal(t, "Amsterdam", fields.City)
+		var parameters struct {
+			AuthServerURL string `json:"authServerURL"`
+			FHIRBaseURL   string `json:"fhirBaseURL"`
+		}
+		require.NoError(t, results[0].DecodeRegistrationParameters(&parameters))
+		require.Equal(t, "https://example.com/oauth2/holder", parameters.AuthServerURL)
+		require.Equal(t, "https://example.com/fhir", parameters.FHIRBaseURL)
+	})
+	t.Run("invalid query", func(t *testing.T) {
+		_, err := Search(ctx, client, "care", NewQuery().Exists(""))
+
+		require.EqualError(t, err, "invalid query: invalid query path: ")
+	})
+	t.Run("unknown service", func(t *testing.T) {
+		_, err := GetService(ctx, client, "other")
+
+		require.EqualError(t, err, "discovery service not found: other")
+	})
+}
@@ -0,0 +1,222 @@
+package discovery
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	ssi "github.com/nuts-foundation/go-did"
+	"github.com/nuts-foundation/go-did/vc"
+	"github.com/nuts-foundation/go-nuts-client/nuts"
+	"reflect"
+	"slices"
+)
+
+// RegistrationParameters are the parameters a subject registers on a Discovery Service,
+// which end up in the credentialSubject of its DiscoveryRegistrationCredential (e.g. endpoints).
+type RegistrationParameters map[string]interface{}
+
+// DesiredActivations maps subject IDs to the Discovery Services (by ID) they must be activated on, with their registration parameters.
+// The listed subjects are deactivated on all other Discovery Services, subjects that aren't listed are left alone.
+type DesiredActivations map[string]map[string]RegistrationParameters
+
+// ActivationAction is the action the reconciler takes to bring a subject's activation of a Discovery Service in the desired state.
+type ActivationAction string
+
+const (
+	// ActionActivate (re)activates the Discovery Service for the subject, with the desired registration parameters.
+	ActionActivate ActivationAction = "activate"
+	// ActionDeactivate deactivates the Discovery Service for the subject.
+	ActionDeactivate ActivationAction = "deactivate"
+)
+
+// ActivationChange is a change the reconciler made (or would make, in dry-run mode).
+type ActivationChange struct {
+	SubjectID string
+	ServiceID string
+	Action    ActivationAction
+	// Reason describes why the change is needed.
+	Reason string
+	// Warning contains the reason the Nuts node gave for not (yet) being able to (de)register the subject on the Discovery Server.
+	// The Nuts node retries this in the background.
+	Warning string
+	// Err contains the error that occurred while making the change.
+	Err error
+}
+
+// ReconcileReport describes the result of reconciling the activations.
+type ReconcileReport struct {
+	// DryRun indicates the changes weren't made.
+	DryRun bool
+	// Changes contains the (needed) changes, ordered by subject and service.
+	Changes []ActivationChange
+	// Unchanged is the number of activations that were already in the desired state.
+	Unchanged int
+}
+
+// Reconciler brings the activations of Discovery Services for subjects in the desired state.
+// Reconciling is idempotent: activations already in the desired state aren't touched.
+type Reconciler struct {
+	// Client is the client of the Discovery API of the Nuts node.
+	Client ClientInterface
+	// DryRun makes the reconciler only report the changes, without making them.
+	DryRun bool
+}
+
+// Reconcile compares the desired activations with the current activations and (unless in dry-run mode) activates or deactivates
+// Discovery Services as needed. A subject must be (re)activated if it isn't activated, if it has no registered presentations,
+// or if the registration parameters of its registered presentations differ from the desired ones.
+// Failed changes are reported and don't stop the reconciliation; the returned error joins their errors.
+// If a desired Discovery Service doesn't exist, an error is returned before any change is made.
+func (r Reconciler) Reconcile(ctx context.Context, desired DesiredActivations) (*ReconcileReport, error) {
+	httpResponse, err := r.Client.GetServices(ctx)
+	response, err := nuts.ParseResponse(err, httpResponse, ParseGetServicesResponse)
+	if err != nil {
+		return nil, fmt.Errorf("list discovery services: %w", err)
+	}
+	if response.JSON200 == nil {
+		return nil, fmt.Errorf("failed list discovery services response: %s", response.Status())
+	}
+	services := make(map[string]bool)
+	for _, service := range *response.JSON200 {
+		services[service.Id] = true
+	}
+	for _, subjectID := range nuts.SortedKeys(desired) {
+		for _, serviceID := range nuts.SortedKeys(desired[subjectID]) {
+			if !services[serviceID] {
+				return nil, fmt.Errorf("discovery service not found: %s", serviceID)
+			}
+		}
+	}
+	report := ReconcileReport{DryRun: r.DryRun}
+	var errs []error
+	for _, subjectID := range nuts.SortedKeys(desired) {
+		for _, serviceID := range nuts.SortedKeys(services) {
+			parameters, wanted := desired[subjectID][serviceID]
+			change, err := r.plan(ctx, subjectID, serviceID, wanted, parameters)
+			if err != nil {
+				errs = append(errs, err)
+				report.Changes = append(report.Changes, ActivationChange{SubjectID: subjectID, ServiceID: serviceID, Err: err})
+				continue
+			}
+			if change == nil {
+				report.Unchanged++
+				continue
+			}
+			if !r.DryRun {
+				r.apply(ctx, change, parameters)
+				if change.Err != nil {
+					errs = append(errs, change.Err)
+				}
+			}
+			report.Changes = append(report.Changes, *change)
+		}
+	}
+	return &report, errors.Join(errs...)
+}
+
+// plan returns the change needed to bring the activation in the desired state, or nil if it's already in the desired state.
+func (r Reconciler) plan(ctx context.Context, subjectID string, serviceID string, wanted bool, parameters RegistrationParameters) (*ActivationChange, error) {
+	httpResponse, err := r.Client.GetServiceActivation(ctx, serviceID, subjectID)
+	response, err := nuts.ParseResponse(err, httpResponse, ParseGetServiceActivationResponse)
+	if err != nil {
+		return nil, fmt.Errorf("get activation of %s for %s: %w", serviceID, subjectID, err)
+	}
+	if response.JSON200 == nil {
+		return nil, fmt.Errorf("failed get activation of %s for %s response: %s", serviceID, subjectID, response.Status())
+	}
+	activation := response.JSON200
+	change := &ActivationChange{SubjectID: subjectID, ServiceID: serviceID}
+	switch {
+	case !wanted && activation.Activated:
+		change.Action = ActionDeactivate
+		change.Reason = "service is activated, but not desired"
+	case !wanted:
+		return nil, nil
+	case !activation.Activated:
+		change.Action = ActionActivate
+		change.Reason = "service is not activated"
+	case activation.Vp == nil || len(*activation.Vp) == 0:
+		change.Action = ActionActivate
+		change.Reason = "subject has no registered presentations"
+	default:
+		for _, presentation := range *activation.Vp {
+			if !containsParameters(presentation.VerifiableCredential, parameters) {
+				change.Action = ActionActivate
+				change.Reason = "registration parameters differ"
+				return change, nil
+			}
+		}
+		return nil, nil
+	}
+	return change, nil
+}
+
+func (r Reconciler) apply(ctx context.Context, change *ActivationChange, parameters RegistrationParameters) {
+	switch change.Action {
+	case ActionActivate:
+		body := ActivateServiceForSubjectJSONRequestBody{}
+		if len(parameters) > 0 {
+			params := map[string]interface{}(parameters)
+			body.RegistrationParameters = &params
+		}
+		httpResponse, err := r.Client.ActivateServiceForSubject(ctx, change.ServiceID, change.SubjectID, body)
+		response, err := nuts.ParseOptionalJSONResponse(err, httpResponse, ParseActivateServiceForSubjectResponse)
+		if err != nil {
+			change.Err = fmt.Errorf("activate %s for %s: %w", change.ServiceID, change.SubjectID, err)
+		} else if response.JSON202 != nil {
+			change.Warning = response.JSON202.Reason
+		}
+	case ActionDeactivate:
+		httpResponse, err := r.Client.DeactivateServiceForSubject(ctx, change.ServiceID, change.SubjectID)
+		response, err := nuts.ParseOptionalJSONResponse(err, httpResponse, ParseDeactivateServiceForSubjectResponse)
+		if err != nil {
+			change.Err = fmt.Errorf("deactivate %s for %s: %w", change.ServiceID, change.SubjectID, err)
+		} else if response.JSON202 != nil {
+			change.Warning = response.JSON202.Reason
+		}
+	}
+}
+
+// serverRegistrationParameters are added to the credentialSubject of the DiscoveryRegistrationCredential by the Nuts node,
+// so they're only compared if they're part of the desired registration parameters.
+var serverRegistrationParameters = []string{"id", "authServerURL"}
+
+// containsParameters reports whether the DiscoveryRegistrationCredential among the credentials contains exactly the registration parameters,
+// apart from the parameters added by the Nuts node (see serverRegistrationParameters).
+func containsParameters(credentials []vc.VerifiableCredential, parameters RegistrationParameters) bool {
+	registrationType := ssi.MustParseURI("DiscoveryRegistrationCredential")
+	for _, credential := range credentials {
+		if !credential.IsType(registrationType) {
+			continue
+		}
+		var subjects []map[string]interface{}
+		if err := credential.UnmarshalCredentialSubject(&subjects); err != nil || len(subjects) == 0 {
+			return false
+		}
+		for key := range subjects[0] {
+			if _, desired := parameters[key]; !desired && !slices.Contains(serverRegistrationParameters, key) {
+				return false
+			}
+		}
+		for key, value := range parameters {
+			if !jsonEqual(subjects[0][key], value) {
+				return false
+			}
+		}
+		return true
+	}
+	return len(parameters) == 0
+}
+
+// jsonEqual reports whether the values are equal in their JSON form, e.g. an int and a float64 with the same value.
+func jsonEqual(a interface{}, b interface{}) bool {
+	var normalized [2]interface{}
+	for i, value := range []interface{}{a, b} {
+		data, err := json.Marshal(value)
+		if err != nil || json.Unmarshal(data, &normalized[i]) != nil {
+			return false
+		}
+	}
+	return reflect.DeepEqual(normalized[0], normalized[1])
+}
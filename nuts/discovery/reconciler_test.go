@@ -0,0 +1,131 @@
+package discovery
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+func registrationPresentation(subjectID string, endpoint string) string {
+	return `{
+  "@context": ["https://www.w3.org/2018/credentials/v1"],
+  "type": "VerifiablePresentation",
+  "verifiableCredential": [{
+    "@context": ["https://www.w3.org/2018/credentials/v1", "https://nuts.nl/credentials/v1"],
+    "type": ["VerifiableCredential", "DiscoveryRegistrationCredential"],
+    "issuer": "` + subjectID + `",
+    "issuanceDate": "2024-01-01T00:00:00Z",
+    "credentialSubject": {"id": "` + subjectID + `", "authServerURL": "https://example.com/oauth2", "endpoint": "` + endpoint + `", "weight": 1}
+  }]
+}`
+}
+
+func TestReconciler_Reconcile(t *testing.T) {
+	activations := map[string]string{
+		"billing/a": `{"activated": true, "vp": []}`,
+		"care/b":    `{"activated": true, "vp": [` + registrationPresentation("did:web:b", "https://b.example.com") + `]}`,
+		"care/c":    `{"activated": true, "vp": [` + registrationPresentation("did:web:c", "https://old.example.com") + `]}`,
+		"care/d":    `{"activated": true, "vp": [` + registrationPresentation("did:web:d", "https://d.example.com") + `]}`,
+	}
+	var mux sync.Mutex
+	var calls []string
+	handler := http.NewServeMux()
+	handler.HandleFunc("GET /internal/discovery/v1", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte(`[{"id": "care", "presentation_definition": {}}, {"id": "billing", "presentation_definition": {}}]`))
+	})
+	handler.HandleFunc("GET /internal/discovery/v1/{serviceID}/{subjectID}", func(w http.ResponseWriter, r *http.Request) {
+		response, ok := activations[r.PathValue("serviceID")+"/"+r.PathValue("subjectID")]
+		if !ok {
+			response = `{"activated": false}`
+		}
+		if r.PathValue("subjectID") == "broken" {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte(response))
+	})
+	handler.HandleFunc("POST /internal/discovery/v1/{serviceID}/{subjectID}", func(w http.ResponseWriter, r *http.Request) {
+		var body ServiceActivationRequest
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		mux.Lock()
+		calls = append(calls, "activate "+r.PathValue("serviceID")+"/"+r.PathValue("subjectID"))
+		mux.Unlock()
+		if r.PathValue("subjectID") == "c" {
+			require.Equal(t, "https://c.example.com", (*body.RegistrationParameters)["endpoint"])
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusAccepted)
+			_, _ = w.Write([]byte(`{"reason": "discovery server unavailable"}`))
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	})
+	handler.HandleFunc("DELETE /internal/discovery/v1/{serviceID}/{subjectID}", func(w http.ResponseWriter, r *http.Request) {
+		mux.Lock()
+		calls = append(calls, "deactivate "+r.PathValue("serviceID")+"/"+r.PathValue("subjectID"))
+		mux.Unlock()
+		w.WriteHeader(http.StatusOK)
+	})
+	httpServer := httptest.NewServer(handler)
+	client, _ := NewClient(httpServer.URL)
+	desired := DesiredActivations{
+		"a": {"care": nil},
+		"b": {"care": {"endpoint": "https://b.example.com", "weight": 1}},
+		"c": {"care": {"endpoint": "https://c.example.com"}},
+		// weight is no longer desired
+		"d": {"care": {"endpoint": "https://d.example.com"}},
+	}
+	expectedChanges := []ActivationChange{
+		{SubjectID: "a", ServiceID: "billing", Action: ActionDeactivate, Reason: "service is activated, but not desired"},
+		{SubjectID: "a", ServiceID: "care", Action: ActionActivate, Reason: "service is not activated"},
+		{SubjectID: "c", ServiceID: "care", Action: ActionActivate, Reason: "registration parameters differ"},
+		{SubjectID: "d", ServiceID: "care", Action: ActionActivate, Reason: "registration parameters differ"},
+	}
+
+	t.Run("dry-run", func(t *testing.T) {
+		calls = nil
+
+		report, err := Reconciler{Client: client, DryRun: true}.Reconcile(context.Background(), desired)
+
+		require.NoError(t, err)
+		require.True(t, report.DryRun)
+		require.Equal(t, expectedChanges, report.Changes)
+		require.Equal(t, 4, report.Unchanged)
+		require.Empty(t, calls)
+	})
+	t.Run("apply", func(t *testing.T) {
+		calls = nil
+
+		report, err := Reconciler{Client: client}.Reconcile(context.Background(), desired)
+
+		require.NoError(t, err)
+		require.False(t, report.DryRun)
+		expectedChanges[2].Warning = "discovery server unavailable"
+		require.Equal(t, expectedChanges, report.Changes)
+		require.Equal(t, []string{"deactivate billing/a", "activate care/a", "activate care/c", "activate care/d"}, calls)
+	})
+	t.Run("unknown service", func(t *testing.T) {
+		calls = nil
+
+		report, err := Reconciler{Client: client}.Reconcile(context.Background(), DesiredActivations{"a": {"care": nil}, "b": {"other": nil}})
+
+		require.EqualError(t, err, "discovery service not found: other")
+		require.Nil(t, report)
+		require.Empty(t, calls)
+	})
+	t.Run("failure is reported", func(t *testing.T) {
+		report, err := Reconciler{Client: client, DryRun: true}.Reconcile(context.Background(), DesiredActivations{"broken": {}, "b": {"care": {"endpoint": "https://b.example.com", "weight": 1}}})
+
+		require.ErrorContains(t, err, "get activation of billing for broken")
+		require.Len(t, report.Changes, 2)
+		require.Error(t, report.Changes[0].Err)
+		require.Equal(t, 2, report.Unchanged)
+	})
+}
@@ -0,0 +1,229 @@
+package discovery
+
+import (
+	"context"
+	"fmt"
+	"github.com/nuts-foundation/go-nuts-client/nuts/pe"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultReplicaRefreshInterval is the interval at which a Replica is refreshed if Replica.RefreshInterval is not set.
+const DefaultReplicaRefreshInterval = time.Minute
+
+// Replica is an in-process replica of the presentations of a Discovery Service, which is refreshed in the background (see Run).
+// Queries are evaluated locally against a Snapshot, so the Nuts node is only queried on refresh.
+// Client and ServiceID must be set, and it must not be copied after first use.
+type Replica struct {
+	// Client is the client of the Discovery API of the Nuts node.
+	Client ClientInterface
+	// ServiceID is the ID of the Discovery Service to replicate.
+	ServiceID string
+	// RefreshInterval is the interval at which the replica is refreshed. If not set, DefaultReplicaRefreshInterval is used.
+	RefreshInterval time.Duration
+	// MaxBackoff is the maximum time to wait before retrying, after subsequent refreshes failed. If not set, DefaultWatchMaxBackoff is used.
+	MaxBackoff time.Duration
+	// StaleAfter is the age after which the replica is considered stale. If not set, it's twice the RefreshInterval.
+	StaleAfter time.Duration
+	// OnError is optionally called when a refresh fails.
+	OnError func(err error)
+
+	mux      sync.RWMutex
+	snapshot *Snapshot
+	lastErr  error
+}
+
+// Snapshot is an immutable, consistent view of the presentations of a Discovery Service at a point in time.
+type Snapshot struct {
+	// Results contains the presentations of the Discovery Service.
+	Results []SearchResult
+	// RefreshedAt is the time the snapshot was retrieved from the Nuts node. It's zero if the replica was never refreshed.
+	RefreshedAt time.Time
+	// documents contains the credentials (as generic maps) of the presentation of each result
+	documents [][]map[string]interface{}
+}
+
+// Run refreshes the replica until the context is cancelled. Failed refreshes are retried with backoff,
+// while the replica keeps serving the last successfully retrieved snapshot.
+func (r *Replica) Run(ctx context.Context) {
+	wait := time.Duration(0)
+	failures := 0
+	for {
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+		if err := r.Refresh(ctx); err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			if r.OnError != nil {
+				r.OnError(err)
+			}
+			wait = backoff(r.refreshInterval(), r.MaxBackoff, failures)
+			failures++
+			continue
+		}
+		failures = 0
+		wait = r.refreshInterval()
+	}
+}
+
+// Refresh retrieves all presentations of the Discovery Service and replaces the snapshot.
+func (r *Replica) Refresh(ctx context.Context) error {
+	results, err := Search(ctx, r.Client, r.ServiceID, NewQuery())
+	if err == nil {
+		var snapshot *Snapshot
+		if snapshot, err = newSnapshot(results); err == nil {
+			r.mux.Lock()
+			r.snapshot = snapshot
+			r.lastErr = nil
+			r.mux.Unlock()
+			return nil
+		}
+	}
+	r.mux.Lock()
+	r.lastErr = err
+	r.mux.Unlock()
+	return err
+}
+
+// Snapshot returns the current snapshot. If the replica was never refreshed, the snapshot is empty.
+func (r *Replica) Snapshot() *Snapshot {
+	r.mux.RLock()
+	defer r.mux.RUnlock()
+	if r.snapshot == nil {
+		return &Snapshot{}
+	}
+	return r.snapshot
+}
+
+// Search evaluates the query against the current snapshot.
+func (r *Replica) Search(query Query) ([]SearchResult, error) {
+	return r.Snapshot().Search(query)
+}
+
+// Stale reports whether the replica is stale: it was never refreshed, or it wasn't refreshed for longer than StaleAfter.
+func (r *Replica) Stale() bool {
+	staleAfter := r.StaleAfter
+	if staleAfter <= 0 {
+		staleAfter = 2 * r.refreshInterval()
+	}
+	snapshot := r.Snapshot()
+	return snapshot.RefreshedAt.IsZero() || snapshot.Age() > staleAfter
+}
+
+// LastError returns the error of the last refresh, or nil if it succeeded.
+func (r *Replica) LastError() error {
+	r.mux.RLock()
+	defer r.mux.RUnlock()
+	return r.lastErr
+}
+
+func (r *Replica) refreshInterval() time.Duration {
+	if r.RefreshInterval <= 0 {
+		return DefaultReplicaRefreshInterval
+	}
+	return r.RefreshInterval
+}
+
+func newSnapshot(results []SearchResult) (*Snapshot, error) {
+	result := Snapshot{
+		Results:     results,
+		RefreshedAt: time.Now(),
+		documents:   make([][]map[string]interface{}, len(results)),
+	}
+	for i, curr := range results {
+		for _, credential := range curr.Vp.VerifiableCredential {
+			document, err := pe.CredentialDocument(credential)
+			if err != nil {
+				return nil, fmt.Errorf("presentation %s: %w", curr.Id, err)
+			}
+			result.documents[i] = append(result.documents[i], document)
+		}
+	}
+	return &result, nil
+}
+
+// Age returns the time since the snapshot was retrieved from the Nuts node.
+func (s *Snapshot) Age() time.Duration {
+	if s.RefreshedAt.IsZero() {
+		return 0
+	}
+	return time.Since(s.RefreshedAt)
+}
+
+// Search returns the results that match the query, in the order of the snapshot.
+// A result matches if each criterion of the query matches a field of any credential in its presentation.
+// Values are compared case-insensitively, to support type-ahead searches.
+func (s *Snapshot) Search(query Query) ([]SearchResult, error) {
+	if _, err := query.Params(); err != nil {
+		return nil, err
+	}
+	var results []SearchResult
+	for i, result := range s.Results {
+		if s.matches(i, query) {
+			results = append(results, result)
+		}
+	}
+	return results, nil
+}
+
+func (s *Snapshot) matches(index int, query Query) bool {
+	for path, pattern := range query.criteria {
+		matched := false
+		for _, document := range s.documents[index] {
+			values, err := pe.ResolveJSONPath(document, "$."+path)
+			if err != nil {
+				return false
+			}
+			if matchesAny(values, pattern) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+	return true
+}
+
+// matchesAny reports whether any of the values (or items of array values) matches the query pattern:
+// * matches any non-empty value, a trailing * matches a prefix, a leading * matches a suffix, otherwise the value must be equal.
+func matchesAny(values []interface{}, pattern string) bool {
+	for _, value := range values {
+		if items, ok := value.([]interface{}); ok {
+			if matchesAny(items, pattern) {
+				return true
+			}
+			continue
+		}
+		if value == nil {
+			continue
+		}
+		str := strings.ToLower(fmt.Sprint(value))
+		pattern := strings.ToLower(pattern)
+		switch {
+		case pattern == "*":
+			if str != "" {
+				return true
+			}
+		case strings.HasSuffix(pattern, "*"):
+			if strings.HasPrefix(str, strings.TrimSuffix(pattern, "*")) {
+				return true
+			}
+		case strings.HasPrefix(pattern, "*"):
+			if strings.HasSuffix(str, strings.TrimPrefix(pattern, "*")) {
+				return true
+			}
+		case str == pattern:
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,112 @@
+package discovery
+
+import (
+	"context"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func replicaSearchResult(subjectID string, name string, city string) string {
+	return `{
+  "id": "` + subjectID + `#1",
+  "credential_subject_id": "` + subjectID + `",
+  "fields": {},
+  "registrationParameters": {"authServerURL": "https://example.com/oauth2"},
+  "vp": {
+    "@context": ["https://www.w3.org/2018/credentials/v1"],
+    "type": "VerifiablePresentation",
+    "verifiableCredential": [{
+      "@context": ["https://www.w3.org/2018/credentials/v1", "https://nuts.nl/credentials/v1"],
+      "type": ["VerifiableCredential", "NutsOrganizationCredential"],
+      "issuer": "did:web:example.com:iam:issuer",
+      "issuanceDate": "2024-01-01T00:00:00Z",
+      "credentialSubject": {"id": "` + subjectID + `", "organization": {"name": "` + name + `", "city": "` + city + `"}}
+    }]
+  }
+}`
+}
+
+func TestReplica(t *testing.T) {
+	var requests atomic.Int32
+	var fail atomic.Bool
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /internal/discovery/v1/care", func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		if fail.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte("[" + replicaSearchResult("did:web:a", "Hospital East", "Amsterdam") + "," + replicaSearchResult("did:web:b", "Care Home", "Utrecht") + "]"))
+	})
+	httpServer := httptest.NewServer(mux)
+	client, _ := NewClient(httpServer.URL)
+
+	t.Run("search snapshot", func(t *testing.T) {
+		replica := &Replica{Client: client, ServiceID: "care"}
+		require.True(t, replica.Stale())
+		require.NoError(t, replica.Refresh(context.Background()))
+		requests.Store(0)
+
+		results, err := replica.Search(NewQuery().HasPrefix("credentialSubject.organization.name", "hosp"))
+		require.NoError(t, err)
+		require.Len(t, results, 1)
+		require.Equal(t, "did:web:a", results[0].CredentialSubjectId)
+
+		results, err = replica.Search(NewQuery().Equals("credentialSubject.organization.city", "utrecht").Exists("credentialSubject.organization.name"))
+		require.NoError(t, err)
+		require.Len(t, results, 1)
+		require.Equal(t, "did:web:b", results[0].CredentialSubjectId)
+
+		results, err = replica.Search(NewQuery().Exists("credentialSubject.organization.ura"))
+		require.NoError(t, err)
+		require.Empty(t, results)
+
+		results, err = replica.Search(NewQuery().Equals("type", "NutsOrganizationCredential"))
+		require.NoError(t, err)
+		require.Len(t, results, 2)
+
+		require.Zero(t, requests.Load())
+		require.False(t, replica.Stale())
+	})
+	t.Run("failed refresh keeps snapshot", func(t *testing.T) {
+		replica := &Replica{Client: client, ServiceID: "care", RefreshInterval: time.Millisecond}
+		require.NoError(t, replica.Refresh(context.Background()))
+		snapshot := replica.Snapshot()
+		fail.Store(true)
+		defer fail.Store(false)
+
+		err := replica.Refresh(context.Background())
+
+		require.Error(t, err)
+		require.Equal(t, err, replica.LastError())
+		require.Same(t, snapshot, replica.Snapshot())
+		time.Sleep(5 * time.Millisecond)
+		require.True(t, replica.Stale())
+	})
+	t.Run("run", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		replica := &Replica{Client: client, ServiceID: "care", RefreshInterval: time.Millisecond}
+		done := make(chan struct{})
+		go func() {
+			replica.Run(ctx)
+			close(done)
+		}()
+
+		require.Eventually(t, func() bool {
+			return len(replica.Snapshot().Results) == 2
+		}, time.Second, time.Millisecond)
+		cancel()
+		<-done
+	})
+	t.Run("invalid query", func(t *testing.T) {
+		_, err := (&Replica{}).Search(NewQuery().Exists(""))
+
+		require.EqualError(t, err, "invalid query: invalid query path: ")
+	})
+}
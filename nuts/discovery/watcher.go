@@ -0,0 +1,168 @@
+package discovery
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"time"
+)
+
+// DefaultWatchInterval is the interval at which a Watcher polls the Discovery Service if Watcher.Interval is not set.
+const DefaultWatchInterval = time.Minute
+
+// DefaultWatchMaxBackoff is the maximum time a Watcher waits after failed polls if Watcher.MaxBackoff is not set.
+const DefaultWatchMaxBackoff = 10 * time.Minute
+
+// EventType is the type of change in the registrations of a Discovery Service.
+type EventType string
+
+const (
+	// EventAdded indicates a subject registered on the Discovery Service.
+	EventAdded EventType = "added"
+	// EventUpdated indicates a subject's registration was replaced by a new presentation (e.g. after renewal or a change of its registration parameters).
+	EventUpdated EventType = "updated"
+	// EventRemoved indicates a subject's registration was removed (e.g. it was deactivated or expired).
+	EventRemoved EventType = "removed"
+)
+
+// Event is a change in the registrations of a Discovery Service.
+type Event struct {
+	Type EventType
+	// Result is the registration. For EventRemoved, it's the last known registration.
+	Result SearchResult
+}
+
+// Watcher watches a Discovery Service for changes in its registrations, by periodically searching its presentations
+// and comparing the results to those of the previous search. Registrations are identified by their credential subject ID,
+// a registration with a new presentation ID is reported as updated.
+// The first search reports all registrations as added, so the consumer can build its initial state from the events.
+type Watcher struct {
+	// Client is the client of the Discovery API of the Nuts node.
+	Client ClientInterface
+	// ServiceID is the ID of the Discovery Service to watch.
+	ServiceID string
+	// Query optionally limits the watched registrations.
+	Query Query
+	// Interval is the interval at which the Discovery Service is searched. If not set, DefaultWatchInterval is used.
+	Interval time.Duration
+	// MaxBackoff is the maximum time to wait before retrying, after subsequent searches failed.
+	// The wait time starts at Interval and doubles after every failure. If not set, DefaultWatchMaxBackoff is used.
+	MaxBackoff time.Duration
+	// OnEvent is called for every change, in order. It is required by Run.
+	OnEvent func(event Event)
+	// OnError is optionally called when a search fails.
+	OnError func(err error)
+}
+
+// Run watches the Discovery Service until the context is cancelled, calling OnEvent for every change.
+// It returns nil when the context is cancelled, or an error if the Watcher is misconfigured or the query is invalid.
+func (w Watcher) Run(ctx context.Context) error {
+	if w.Client == nil || w.ServiceID == "" || w.OnEvent == nil {
+		return errors.New("watcher requires Client, ServiceID and OnEvent")
+	}
+	if _, err := w.Query.Params(); err != nil {
+		return err
+	}
+	known := make(map[string]SearchResult)
+	wait := time.Duration(0)
+	failures := 0
+	for {
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil
+		case <-timer.C:
+		}
+		results, err := Search(ctx, w.Client, w.ServiceID, w.Query)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			if w.OnError != nil {
+				w.OnError(err)
+			}
+			wait = backoff(w.interval(), w.MaxBackoff, failures)
+			failures++
+			continue
+		}
+		failures = 0
+		wait = w.interval()
+		for _, event := range diff(known, results) {
+			w.OnEvent(event)
+		}
+	}
+}
+
+// Events starts watching the Discovery Service in the background, and returns the changes on a channel.
+// The channel is closed when the context is cancelled, or when the Watcher can't be started (e.g. when it's misconfigured).
+// The consumer must keep reading the channel, since the Watcher blocks until an event is consumed.
+func (w Watcher) Events(ctx context.Context) <-chan Event {
+	events := make(chan Event)
+	w.OnEvent = func(event Event) {
+		select {
+		case events <- event:
+		case <-ctx.Done():
+		}
+	}
+	go func() {
+		defer close(events)
+		if err := w.Run(ctx); err != nil && w.OnError != nil {
+			w.OnError(err)
+		}
+	}()
+	return events
+}
+
+// diff returns the changes between the known registrations and the results of a search, and updates the known registrations.
+// Events are returned in the order of the results, followed by the removals.
+func diff(known map[string]SearchResult, results []SearchResult) []Event {
+	var events []Event
+	current := make(map[string]bool, len(results))
+	for _, result := range results {
+		current[result.CredentialSubjectId] = true
+		previous, exists := known[result.CredentialSubjectId]
+		switch {
+		case !exists:
+			events = append(events, Event{Type: EventAdded, Result: result})
+		case previous.Id != result.Id:
+			events = append(events, Event{Type: EventUpdated, Result: result})
+		default:
+			continue
+		}
+		known[result.CredentialSubjectId] = result
+	}
+	var removed []Event
+	for subjectID, result := range known {
+		if !current[subjectID] {
+			removed = append(removed, Event{Type: EventRemoved, Result: result})
+			delete(known, subjectID)
+		}
+	}
+	// Sort removals for deterministic ordering, since map iteration isn't
+	slices.SortFunc(removed, func(a, b Event) int {
+		return strings.Compare(a.Result.CredentialSubjectId, b.Result.CredentialSubjectId)
+	})
+	return append(events, removed...)
+}
+
+func (w Watcher) interval() time.Duration {
+	if w.Interval <= 0 {
+		return DefaultWatchInterval
+	}
+	return w.Interval
+}
+
+// backoff returns the time to wait after the given number of subsequent failures: the interval, doubled after every failure.
+// If maxBackoff is not set, DefaultWatchMaxBackoff is used.
+func backoff(interval time.Duration, maxBackoff time.Duration, failures int) time.Duration {
+	if maxBackoff <= 0 {
+		maxBackoff = DefaultWatchMaxBackoff
+	}
+	result := interval
+	for i := 0; i < failures && result < maxBackoff; i++ {
+		result *= 2
+	}
+	return min(result, maxBackoff)
+}
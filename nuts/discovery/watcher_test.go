@@ -0,0 +1,88 @@
+package discovery
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestWatcher(t *testing.T) {
+	responses := [][]SearchResult{
+		{
+			{Id: "a#1", CredentialSubjectId: "a"},
+			{Id: "b#1", CredentialSubjectId: "b"},
+		},
+		nil, // failure
+		{
+			{Id: "a#2", CredentialSubjectId: "a"},
+			{Id: "c#1", CredentialSubjectId: "c"},
+		},
+	}
+	var mux sync.Mutex
+	var requests int
+	httpServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mux.Lock()
+		response := responses[min(requests, len(responses)-1)]
+		requests++
+		mux.Unlock()
+		if response == nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		_ = json.NewEncoder(w).Encode(response)
+	}))
+	client, _ := NewClient(httpServer.URL)
+
+	t.Run("events", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		var errs []error
+		watcher := Watcher{
+			Client:     client,
+			ServiceID:  "care",
+			Interval:   5 * time.Millisecond,
+			MaxBackoff: 10 * time.Millisecond,
+			OnError: func(err error) {
+				errs = append(errs, err)
+			},
+		}
+
+		events := watcher.Events(ctx)
+
+		var actual []string
+		for event := range events {
+			actual = append(actual, string(event.Type)+" "+event.Result.Id)
+			if len(actual) == 5 {
+				cancel()
+			}
+		}
+		require.Equal(t, []string{"added a#1", "added b#1", "updated a#2", "added c#1", "removed b#1"}, actual)
+		require.Len(t, errs, 1)
+	})
+	t.Run("misconfigured", func(t *testing.T) {
+		err := Watcher{Client: client}.Run(context.Background())
+
+		require.EqualError(t, err, "watcher requires Client, ServiceID and OnEvent")
+	})
+	t.Run("invalid query", func(t *testing.T) {
+		err := Watcher{Client: client, ServiceID: "care", Query: NewQuery().Exists(""), OnEvent: func(Event) {}}.Run(context.Background())
+
+		require.EqualError(t, err, "invalid query: invalid query path: ")
+	})
+}
+
+func Test_backoff(t *testing.T) {
+	require.Equal(t, time.Second, backoff(time.Second, 5*time.Second, 0))
+	require.Equal(t, 2*time.Second, backoff(time.Second, 5*time.Second, 1))
+	require.Equal(t, 4*time.Second, backoff(time.Second, 5*time.Second, 2))
+	require.Equal(t, 5*time.Second, backoff(time.Second, 5*time.Second, 3))
+	require.Equal(t, 5*time.Second, backoff(time.Second, 5*time.Second, 100))
+	require.Equal(t, DefaultWatchMaxBackoff, backoff(time.Hour, 0, 0))
+}
@@ -0,0 +1,231 @@
+package nuts
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/nuts-foundation/go-nuts-client/nuts/iam"
+	"github.com/nuts-foundation/go-nuts-client/oauth2"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultDPoPProofMaxAge is the maximum age of a DPoP proof if DPoPValidator.MaxAge is not set.
+const DefaultDPoPProofMaxAge = 5 * time.Minute
+
+// DefaultDPoPClockSkew is the allowed clock skew for the issuance time of a DPoP proof if DPoPValidator.ClockSkew is not set.
+const DefaultDPoPClockSkew = 30 * time.Second
+
+// DPoPValidator validates the DPoP proofs (RFC9449) of requests with DPoP-bound access tokens, using the API of a local Nuts node.
+// Set it as ResourceServer.DPoP, which calls its middleware after introspecting the access token.
+// Besides the checks performed by the Nuts node (signature, method, URL, access token hash and key thumbprint),
+// it enforces proof freshness and prevents replay of proofs by remembering their jti claims.
+type DPoPValidator struct {
+	// NutsAPIURL is the base URL of the Nuts node API.
+	NutsAPIURL string
+	// NutsHttpClient is the HTTP client used to communicate with the Nuts node.
+	// If not set, http.DefaultClient is used.
+	NutsHttpClient *http.Client
+	// ResourceMetadataURL is the URL of the protected resource metadata, which is advertised in the WWW-Authenticate challenge.
+	ResourceMetadataURL string
+	// BaseURL is the external base URL of the resource server (e.g. https://resource.example.com), used to reconstruct the request URL.
+	// It must be set if the resource server is behind a reverse proxy. If not set, it is derived from the request.
+	BaseURL string
+	// MaxAge is the maximum age of a DPoP proof. If not set, DefaultDPoPProofMaxAge is used.
+	MaxAge time.Duration
+	// ClockSkew is the allowed clock skew for the issuance time of a DPoP proof. If not set, DefaultDPoPClockSkew is used.
+	ClockSkew time.Duration
+	// Nonce optionally returns the current server-provided nonce, which DPoP proofs must contain.
+	// If a proof doesn't contain it, the request is rejected with a use_dpop_nonce error and the nonce in the DPoP-Nonce header.
+	Nonce func() string
+
+	mux        sync.Mutex
+	usedProofs map[string]time.Time
+	nextPurge  time.Time
+}
+
+type dpopProofClaims struct {
+	JwtID    string `json:"jti"`
+	IssuedAt int64  `json:"iat"`
+	Nonce    string `json:"nonce"`
+}
+
+// Middleware returns a middleware that validates the DPoP proof of requests with DPoP-bound access tokens.
+// Requests with access tokens that aren't DPoP-bound are passed on as-is, if they use the Bearer scheme.
+func (v *DPoPValidator) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(response http.ResponseWriter, httpRequest *http.Request) {
+		introspection, err := IntrospectionResult(httpRequest.Context())
+		if err != nil {
+			http.Error(response, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		scheme, token := ParseAuthorizationHeader(httpRequest)
+		if introspection.Cnf == nil {
+			if scheme == "DPoP" {
+				v.challenge(response, "invalid_token", "access token is not DPoP-bound")
+				return
+			}
+			next.ServeHTTP(response, httpRequest)
+			return
+		}
+		if scheme != "DPoP" {
+			v.challenge(response, "invalid_token", "DPoP-bound access token must be presented with the DPoP scheme")
+			return
+		}
+		proofs := httpRequest.Header.Values("DPoP")
+		if len(proofs) != 1 {
+			v.challenge(response, "invalid_dpop_proof", "exactly one DPoP proof is required")
+			return
+		}
+		claims, err := parseDPoPProofClaims(proofs[0])
+		if err != nil {
+			v.challenge(response, "invalid_dpop_proof", err.Error())
+			return
+		}
+		if err := v.checkFreshness(*claims); err != nil {
+			v.challenge(response, "invalid_dpop_proof", err.Error())
+			return
+		}
+		if v.Nonce != nil {
+			if nonce := v.Nonce(); claims.Nonce != nonce {
+				response.Header().Set("DPoP-Nonce", nonce)
+				v.challenge(response, "use_dpop_nonce", "DPoP proof must contain the server-provided nonce")
+				return
+			}
+		}
+		result, err := v.validate(httpRequest, iam.DPoPValidateRequest{
+			DpopProof:  proofs[0],
+			Method:     httpRequest.Method,
+			Thumbprint: introspection.Cnf.Jkt,
+			Token:      token,
+			Url:        v.requestURL(httpRequest),
+		})
+		if err != nil {
+			http.Error(response, "DPoP proof validation failed", http.StatusBadGateway)
+			return
+		}
+		if !result.Valid {
+			reason := "DPoP proof is invalid"
+			if result.Reason != nil {
+				reason = *result.Reason
+			}
+			v.challenge(response, "invalid_dpop_proof", reason)
+			return
+		}
+		if !v.markUsed(introspection.Cnf.Jkt+"/"+claims.JwtID, time.Unix(claims.IssuedAt, 0)) {
+			v.challenge(response, "invalid_dpop_proof", "DPoP proof has already been used")
+			return
+		}
+		next.ServeHTTP(response, httpRequest)
+	})
+}
+
+func (v *DPoPValidator) validate(httpRequest *http.Request, request iam.DPoPValidateRequest) (*iam.DPoPValidateResponse, error) {
+	client, err := newIAMClient(v.NutsAPIURL, v.NutsHttpClient)
+	if err != nil {
+		return nil, err
+	}
+	httpResponse, err := client.ValidateDPoPProof(httpRequest.Context(), request)
+	response, err := ParseResponse(err, httpResponse, iam.ParseValidateDPoPProofResponse)
+	if err != nil {
+		return nil, fmt.Errorf("DPoP proof validation: %w", err)
+	}
+	if response.JSON200 == nil {
+		return nil, fmt.Errorf("failed DPoP proof validation response: %s", response.Status())
+	}
+	return response.JSON200, nil
+}
+
+func (v *DPoPValidator) checkFreshness(claims dpopProofClaims) error {
+	if claims.JwtID == "" {
+		return errors.New("DPoP proof is missing jti")
+	}
+	issuedAt := time.Unix(claims.IssuedAt, 0)
+	now := time.Now()
+	if claims.IssuedAt == 0 || issuedAt.After(now.Add(v.clockSkew())) {
+		return errors.New("DPoP proof has an invalid issuance time")
+	}
+	if issuedAt.Add(v.maxAge()).Before(now) {
+		return errors.New("DPoP proof has expired")
+	}
+	return nil
+}
+
+// markUsed records the proof as used, until it expires. It returns false if the proof was already used.
+func (v *DPoPValidator) markUsed(key string, issuedAt time.Time) bool {
+	v.mux.Lock()
+	defer v.mux.Unlock()
+	now := time.Now()
+	if v.usedProofs == nil {
+		v.usedProofs = make(map[string]time.Time)
+	}
+	if now.After(v.nextPurge) {
+		for curr, expiry := range v.usedProofs {
+			if now.After(expiry) {
+				delete(v.usedProofs, curr)
+			}
+		}
+		v.nextPurge = now.Add(v.maxAge())
+	}
+	if _, used := v.usedProofs[key]; used {
+		return false
+	}
+	v.usedProofs[key] = issuedAt.Add(v.maxAge() + v.clockSkew())
+	return true
+}
+
+func (v *DPoPValidator) requestURL(httpRequest *http.Request) string {
+	baseURL := strings.TrimSuffix(v.BaseURL, "/")
+	if baseURL == "" {
+		scheme := "http"
+		if httpRequest.TLS != nil {
+			scheme = "https"
+		}
+		baseURL = scheme + "://" + httpRequest.Host
+	}
+	return baseURL + httpRequest.URL.EscapedPath()
+}
+
+func (v *DPoPValidator) challenge(response http.ResponseWriter, errorCode string, errorDescription string) {
+	oauth2.WriteChallenge(response, oauth2.Challenge{
+		Scheme:           "DPoP",
+		Error:            errorCode,
+		ErrorDescription: errorDescription,
+		ResourceMetadata: v.ResourceMetadataURL,
+	})
+}
+
+func (v *DPoPValidator) maxAge() time.Duration {
+	if v.MaxAge <= 0 {
+		return DefaultDPoPProofMaxAge
+	}
+	return v.MaxAge
+}
+
+func (v *DPoPValidator) clockSkew() time.Duration {
+	if v.ClockSkew <= 0 {
+		return DefaultDPoPClockSkew
+	}
+	return v.ClockSkew
+}
+
+// parseDPoPProofClaims returns the claims of the DPoP proof (JWT), without verifying its signature.
+// The signature is verified by the Nuts node.
+func parseDPoPProofClaims(proof string) (*dpopProofClaims, error) {
+	parts := strings.Split(proof, ".")
+	if len(parts) != 3 {
+		return nil, errors.New("DPoP proof is not a JWT")
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, fmt.Errorf("DPoP proof is not a JWT: %w", err)
+	}
+	var claims dpopProofClaims
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return nil, fmt.Errorf("DPoP proof is not a JWT: %w", err)
+	}
+	return &claims, nil
+}
@@ -0,0 +1,176 @@
+package nuts
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"github.com/nuts-foundation/go-nuts-client/nuts/iam"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestDPoPValidator_Middleware(t *testing.T) {
+	var capturedRequest iam.DPoPValidateRequest
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /internal/auth/v2/accesstoken/introspect", func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, r.ParseForm())
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		if r.PostForm.Get("token") == "dpop-token" {
+			_, _ = w.Write([]byte(`{"active":true,"cnf":{"jkt":"thumbprint"}}`))
+		} else {
+			_, _ = w.Write([]byte(`{"active":true}`))
+		}
+	})
+	mux.HandleFunc("POST /internal/auth/v2/dpop/validate", func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&capturedRequest))
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		if capturedRequest.Method == http.MethodPost {
+			_, _ = w.Write([]byte(`{"valid":false,"reason":"method mismatch"}`))
+		} else {
+			_, _ = w.Write([]byte(`{"valid":true}`))
+		}
+	})
+	httpServer := httptest.NewServer(mux)
+	createProof := func(jti string, iat time.Time, nonce string) string {
+		claims, _ := json.Marshal(map[string]interface{}{"jti": jti, "iat": iat.Unix(), "nonce": nonce, "htm": "GET"})
+		return "eyJhbGciOiJFUzI1NiJ9." + base64.RawURLEncoding.EncodeToString(claims) + ".c2lnbmF0dXJl"
+	}
+	serve := func(validator *DPoPValidator, method string, authorization string, proof string) *httptest.ResponseRecorder {
+		handler := ResourceServer{NutsAPIURL: httpServer.URL, DPoP: validator}.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusNoContent)
+		}))
+		httpRequest := httptest.NewRequest(method, "https://resource.example.com/fhir/Patient?id=1", nil)
+		httpRequest.Header.Set("Authorization", authorization)
+		if proof != "" {
+			httpRequest.Header.Set("DPoP", proof)
+		}
+		response := httptest.NewRecorder()
+		handler.ServeHTTP(response, httpRequest)
+		return response
+	}
+
+	t.Run("valid proof", func(t *testing.T) {
+		validator := &DPoPValidator{NutsAPIURL: httpServer.URL}
+
+		response := serve(validator, http.MethodGet, "DPoP dpop-token", createProof("1", time.Now(), ""))
+
+		require.Equal(t, http.StatusNoContent, response.Code)
+		require.Equal(t, "thumbprint", capturedRequest.Thumbprint)
+		require.Equal(t, "dpop-token", capturedRequest.Token)
+		require.Equal(t, "https://resource.example.com/fhir/Patient", capturedRequest.Url)
+		require.Equal(t, http.MethodGet, capturedRequest.Method)
+	})
+	t.Run("configured base URL", func(t *testing.T) {
+		validator := &DPoPValidator{NutsAPIURL: httpServer.URL, BaseURL: "https://proxy.example.com/api/"}
+
+		response := serve(validator, http.MethodGet, "DPoP dpop-token", createProof("1", time.Now(), ""))
+
+		require.Equal(t, http.StatusNoContent, response.Code)
+		require.Equal(t, "https://proxy.example.com/api/fhir/Patient", capturedRequest.Url)
+	})
+	t.Run("replayed proof", func(t *testing.T) {
+		validator := &DPoPValidator{NutsAPIURL: httpServer.URL}
+		proof := createProof("1", time.Now(), "")
+
+		response := serve(validator, http.MethodGet, "DPoP dpop-token", proof)
+		require.Equal(t, http.StatusNoContent, response.Code)
+		response = serve(validator, http.MethodGet, "DPoP dpop-token", proof)
+
+		require.Equal(t, http.StatusUnauthorized, response.Code)
+		require.Equal(t, `DPoP error="invalid_dpop_proof", error_description="DPoP proof has already been used"`, response.Header().Get("WWW-Authenticate"))
+	})
+	t.Run("expired proof", func(t *testing.T) {
+		validator := &DPoPValidator{NutsAPIURL: httpServer.URL, MaxAge: time.Minute}
+
+		response := serve(validator, http.MethodGet, "DPoP dpop-token", createProof("1", time.Now().Add(-2*time.Minute), ""))
+
+		require.Equal(t, http.StatusUnauthorized, response.Code)
+		require.Contains(t, response.Header().Get("WWW-Authenticate"), "DPoP proof has expired")
+	})
+	t.Run("proof issued in the future", func(t *testing.T) {
+		validator := &DPoPValidator{NutsAPIURL: httpServer.URL}
+
+		response := serve(validator, http.MethodGet, "DPoP dpop-token", createProof("1", time.Now().Add(time.Hour), ""))
+
+		require.Equal(t, http.StatusUnauthorized, response.Code)
+		require.Contains(t, response.Header().Get("WWW-Authenticate"), "DPoP proof has an invalid issuance time")
+	})
+	t.Run("invalid proof according to Nuts node", func(t *testing.T) {
+		validator := &DPoPValidator{NutsAPIURL: httpServer.URL}
+
+		response := serve(validator, http.MethodPost, "DPoP dpop-token", createProof("1", time.Now(), ""))
+
+		require.Equal(t, http.StatusUnauthorized, response.Code)
+		require.Contains(t, response.Header().Get("WWW-Authenticate"), `error_description="method mismatch"`)
+	})
+	t.Run("missing proof", func(t *testing.T) {
+		validator := &DPoPValidator{NutsAPIURL: httpServer.URL}
+
+		response := serve(validator, http.MethodGet, "DPoP dpop-token", "")
+
+		require.Equal(t, http.StatusUnauthorized, response.Code)
+		require.Contains(t, response.Header().Get("WWW-Authenticate"), `error="invalid_dpop_proof"`)
+	})
+	t.Run("nonce required", func(t *testing.T) {
+		validator := &DPoPValidator{NutsAPIURL: httpServer.URL, Nonce: func() string {
+			return "server-nonce"
+		}}
+
+		response := serve(validator, http.MethodGet, "DPoP dpop-token", createProof("1", time.Now(), ""))
+		require.Equal(t, http.StatusUnauthorized, response.Code)
+		require.Equal(t, "server-nonce", response.Header().Get("DPoP-Nonce"))
+		require.Contains(t, response.Header().Get("WWW-Authenticate"), `error="use_dpop_nonce"`)
+
+		response = serve(validator, http.MethodGet, "DPoP dpop-token", createProof("2", time.Now(), "server-nonce"))
+		require.Equal(t, http.StatusNoContent, response.Code)
+	})
+	t.Run("DPoP-bound token with Bearer scheme", func(t *testing.T) {
+		validator := &DPoPValidator{NutsAPIURL: httpServer.URL}
+
+		response := serve(validator, http.MethodGet, "Bearer dpop-token", "")
+
+		require.Equal(t, http.StatusUnauthorized, response.Code)
+		require.Contains(t, response.Header().Get("WWW-Authenticate"), `error="invalid_token"`)
+	})
+	t.Run("Bearer token", func(t *testing.T) {
+		validator := &DPoPValidator{NutsAPIURL: httpServer.URL}
+
+		response := serve(validator, http.MethodGet, "Bearer bearer-token", "")
+
+		require.Equal(t, http.StatusNoContent, response.Code)
+	})
+	t.Run("Bearer token with DPoP scheme", func(t *testing.T) {
+		validator := &DPoPValidator{NutsAPIURL: httpServer.URL}
+
+		response := serve(validator, http.MethodGet, "DPoP bearer-token", createProof("1", time.Now(), ""))
+
+		require.Equal(t, http.StatusUnauthorized, response.Code)
+		require.Contains(t, response.Header().Get("WWW-Authenticate"), "access token is not DPoP-bound")
+	})
+	t.Run("not wrapped by ResourceServer", func(t *testing.T) {
+		validator := &DPoPValidator{NutsAPIURL: httpServer.URL}
+		response := httptest.NewRecorder()
+
+		validator.Middleware(nil).ServeHTTP(response, httptest.NewRequest(http.MethodGet, "/", nil))
+
+		require.Equal(t, http.StatusInternalServerError, response.Code)
+	})
+}
+
+func Test_parseDPoPProofClaims(t *testing.T) {
+	t.Run("not a JWT", func(t *testing.T) {
+		_, err := parseDPoPProofClaims("foo")
+
+		require.EqualError(t, err, "DPoP proof is not a JWT")
+	})
+	t.Run("invalid payload", func(t *testing.T) {
+		_, err := parseDPoPProofClaims(fmt.Sprintf("a.%s.c", base64.RawURLEncoding.EncodeToString([]byte("{"))))
+
+		require.ErrorContains(t, err, "DPoP proof is not a JWT")
+	})
+}
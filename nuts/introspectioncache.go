@@ -0,0 +1,135 @@
+package nuts
+
+import (
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"github.com/nuts-foundation/go-nuts-client/internal/singleflight"
+	"github.com/nuts-foundation/go-nuts-client/nuts/iam"
+	"sync"
+	"time"
+)
+
+// DefaultIntrospectionCacheMaxEntries is the maximum number of cached introspection results if IntrospectionCache.MaxEntries is not set.
+const DefaultIntrospectionCacheMaxEntries = 10000
+
+// DefaultIntrospectionCacheMaxTTL is the maximum time an introspection result is cached if IntrospectionCache.MaxTTL is not set.
+const DefaultIntrospectionCacheMaxTTL = 5 * time.Minute
+
+// DefaultIntrospectionCacheTimeout is the maximum duration of an introspection if IntrospectionCache.Timeout is not set.
+const DefaultIntrospectionCacheTimeout = 10 * time.Second
+
+// IntrospectionCache caches access token introspection results, so not every request requires a round trip to the Nuts node.
+// Results are keyed by the SHA-256 hash of the access token, so the cache doesn't hold the access tokens themselves.
+// Active results are cached until the token expires, but no longer than MaxTTL.
+// Inactive results are only cached for InactiveTTL, which defaults to not caching them at all.
+// Concurrent introspections of the same access token are deduplicated: the introspection isn't cancelled when the first caller is,
+// but is bounded by Timeout.
+// When the cache is full, the least recently used result is evicted.
+type IntrospectionCache struct {
+	// MaxEntries is the maximum number of cached results. If not set, DefaultIntrospectionCacheMaxEntries is used.
+	MaxEntries int
+	// MaxTTL is the maximum time an active result is cached. If not set, DefaultIntrospectionCacheMaxTTL is used.
+	MaxTTL time.Duration
+	// InactiveTTL is the time an inactive result is cached. If not set, inactive results aren't cached.
+	InactiveTTL time.Duration
+	// Timeout is the maximum duration of an introspection. If not set, DefaultIntrospectionCacheTimeout is used.
+	Timeout time.Duration
+
+	mux      sync.Mutex
+	entries  map[[32]byte]*list.Element
+	lru      *list.List
+	inflight singleflight.Group[[32]byte, *iam.TokenIntrospectionResponse]
+}
+
+type introspectionCacheEntry struct {
+	key     [32]byte
+	result  *iam.TokenIntrospectionResponse
+	expires time.Time
+}
+
+// Get returns the cached introspection result for the access token.
+// If it isn't cached (or expired), introspect is called and its result is cached.
+func (c *IntrospectionCache) Get(ctx context.Context, token string, introspect func(ctx context.Context, token string) (*iam.TokenIntrospectionResponse, error)) (*iam.TokenIntrospectionResponse, error) {
+	key := sha256.Sum256([]byte(token))
+	c.mux.Lock()
+	c.init()
+	if element, ok := c.entries[key]; ok {
+		entry := element.Value.(*introspectionCacheEntry)
+		if time.Now().Before(entry.expires) {
+			c.lru.MoveToFront(element)
+			c.mux.Unlock()
+			return entry.result, nil
+		}
+		c.remove(element)
+	}
+	c.mux.Unlock()
+	timeout := c.Timeout
+	if timeout <= 0 {
+		timeout = DefaultIntrospectionCacheTimeout
+	}
+	return c.inflight.Do(ctx, key, timeout, func(ctx context.Context) (*iam.TokenIntrospectionResponse, error) {
+		result, err := introspect(ctx, token)
+		if err != nil {
+			return nil, err
+		}
+		if expires := c.expiry(result); time.Now().Before(expires) {
+			c.mux.Lock()
+			c.add(&introspectionCacheEntry{key: key, result: result, expires: expires})
+			c.mux.Unlock()
+		}
+		return result, nil
+	})
+}
+
+func (c *IntrospectionCache) expiry(result *iam.TokenIntrospectionResponse) time.Time {
+	now := time.Now()
+	if !result.Active {
+		return now.Add(c.InactiveTTL)
+	}
+	maxTTL := c.MaxTTL
+	if maxTTL <= 0 {
+		maxTTL = DefaultIntrospectionCacheMaxTTL
+	}
+	expires := now.Add(maxTTL)
+	if result.Exp != nil {
+		if exp := time.Unix(int64(*result.Exp), 0); exp.Before(expires) {
+			expires = exp
+		}
+	}
+	return expires
+}
+
+func (c *IntrospectionCache) add(entry *introspectionCacheEntry) {
+	if element, ok := c.entries[entry.key]; ok {
+		c.remove(element)
+	}
+	maxEntries := c.MaxEntries
+	if maxEntries <= 0 {
+		maxEntries = DefaultIntrospectionCacheMaxEntries
+	}
+	for c.lru.Len() >= maxEntries {
+		c.remove(c.lru.Back())
+	}
+	c.entries[entry.key] = c.lru.PushFront(entry)
+}
+
+func (c *IntrospectionCache) remove(element *list.Element) {
+	c.lru.Remove(element)
+	delete(c.entries, element.Value.(*introspectionCacheEntry).key)
+}
+
+func (c *IntrospectionCache) init() {
+	if c.entries == nil {
+		c.entries = make(map[[32]byte]*list.Element)
+		c.lru = list.New()
+	}
+}
+
+// Len returns the number of cached introspection results, including expired ones that haven't been evicted yet.
+func (c *IntrospectionCache) Len() int {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	c.init()
+	return c.lru.Len()
+}
@@ -0,0 +1,145 @@
+package nuts
+
+import (
+	"context"
+	"errors"
+	"github.com/nuts-foundation/go-nuts-client/nuts/iam"
+	"github.com/stretchr/testify/require"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestIntrospectionCache_Get(t *testing.T) {
+	ctx := context.Background()
+	active := func(exp time.Time) func(ctx context.Context, token string) (*iam.TokenIntrospectionResponse, error) {
+		return func(_ context.Context, _ string) (*iam.TokenIntrospectionResponse, error) {
+			expUnix := int(exp.Unix())
+			return &iam.TokenIntrospectionResponse{Active: true, Exp: &expUnix}, nil
+		}
+	}
+	t.Run("active result is cached", func(t *testing.T) {
+		cache := &IntrospectionCache{}
+		var calls atomic.Int32
+		introspect := func(ctx context.Context, token string) (*iam.TokenIntrospectionResponse, error) {
+			calls.Add(1)
+			return active(time.Now().Add(time.Hour))(ctx, token)
+		}
+
+		first, err := cache.Get(ctx, "token", introspect)
+		require.NoError(t, err)
+		second, err := cache.Get(ctx, "token", introspect)
+		require.NoError(t, err)
+
+		require.Same(t, first, second)
+		require.Equal(t, int32(1), calls.Load())
+	})
+	t.Run("cached no longer than MaxTTL", func(t *testing.T) {
+		cache := &IntrospectionCache{MaxTTL: time.Millisecond}
+		var calls atomic.Int32
+		introspect := func(ctx context.Context, token string) (*iam.TokenIntrospectionResponse, error) {
+			calls.Add(1)
+			return active(time.Now().Add(time.Hour))(ctx, token)
+		}
+
+		_, _ = cache.Get(ctx, "token", introspect)
+		time.Sleep(5 * time.Millisecond)
+		_, _ = cache.Get(ctx, "token", introspect)
+
+		require.Equal(t, int32(2), calls.Load())
+	})
+	t.Run("expired token is not cached", func(t *testing.T) {
+		cache := &IntrospectionCache{}
+
+		_, err := cache.Get(ctx, "token", active(time.Now().Add(-time.Second)))
+
+		require.NoError(t, err)
+		require.Equal(t, 0, cache.Len())
+	})
+	t.Run("inactive result is not cached by default", func(t *testing.T) {
+		cache := &IntrospectionCache{}
+
+		result, err := cache.Get(ctx, "token", func(_ context.Context, _ string) (*iam.TokenIntrospectionResponse, error) {
+			return &iam.TokenIntrospectionResponse{Active: false}, nil
+		})
+
+		require.NoError(t, err)
+		require.False(t, result.Active)
+		require.Equal(t, 0, cache.Len())
+	})
+	t.Run("error is not cached", func(t *testing.T) {
+		cache := &IntrospectionCache{}
+
+		_, err := cache.Get(ctx, "token", func(_ context.Context, _ string) (*iam.TokenIntrospectionResponse, error) {
+			return nil, errors.New("failed")
+		})
+
+		require.EqualError(t, err, "failed")
+		require.Equal(t, 0, cache.Len())
+	})
+	t.Run("least recently used result is evicted", func(t *testing.T) {
+		cache := &IntrospectionCache{MaxEntries: 2}
+		introspect := active(time.Now().Add(time.Hour))
+
+		_, _ = cache.Get(ctx, "1", introspect)
+		_, _ = cache.Get(ctx, "2", introspect)
+		_, _ = cache.Get(ctx, "1", introspect)
+		_, _ = cache.Get(ctx, "3", introspect)
+
+		require.Equal(t, 2, cache.Len())
+		var calls atomic.Int32
+		_, _ = cache.Get(ctx, "2", func(ctx context.Context, token string) (*iam.TokenIntrospectionResponse, error) {
+			calls.Add(1)
+			return introspect(ctx, token)
+		})
+		require.Equal(t, int32(1), calls.Load())
+	})
+	t.Run("concurrent introspection is deduplicated", func(t *testing.T) {
+		cache := &IntrospectionCache{}
+		var calls atomic.Int32
+		release := make(chan struct{})
+		introspect := func(ctx context.Context, token string) (*iam.TokenIntrospectionResponse, error) {
+			calls.Add(1)
+			<-release
+			return active(time.Now().Add(time.Hour))(ctx, token)
+		}
+		wg := sync.WaitGroup{}
+		for i := 0; i < 10; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				_, err := cache.Get(ctx, "token", introspect)
+				require.NoError(t, err)
+			}()
+		}
+		time.Sleep(10 * time.Millisecond)
+		close(release)
+		wg.Wait()
+
+		require.Equal(t, int32(1), calls.Load())
+	})
+	t.Run("waiting caller's context is cancelled", func(t *testing.T) {
+		cache := &IntrospectionCache{}
+		cancelledCtx, cancel := context.WithCancel(ctx)
+		cancel()
+
+		_, err := cache.Get(cancelledCtx, "token", func(_ context.Context, _ string) (*iam.TokenIntrospectionResponse, error) {
+			time.Sleep(10 * time.Millisecond)
+			return &iam.TokenIntrospectionResponse{Active: true}, nil
+		})
+
+		require.ErrorIs(t, err, context.Canceled)
+	})
+	t.Run("introspection times out", func(t *testing.T) {
+		cache := &IntrospectionCache{Timeout: time.Millisecond}
+
+		_, err := cache.Get(ctx, "token", func(ctx context.Context, _ string) (*iam.TokenIntrospectionResponse, error) {
+			<-ctx.Done()
+			return nil, ctx.Err()
+		})
+
+		require.ErrorIs(t, err, context.DeadlineExceeded)
+		require.Equal(t, 0, cache.Len())
+	})
+}
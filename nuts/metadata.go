@@ -1,8 +1,8 @@
 package nuts
 
 import (
-	ssi "github.com/nuts-foundation/go-did"
 	"github.com/nuts-foundation/go-did/vc"
+	"time"
 )
 
 var _ CredentialProvider = EmployeeDetails{}
@@ -11,26 +11,25 @@ type EmployeeDetails struct {
 	Id   string
 	Name string
 	Role string
+	// ExpirationDate is the optional expirationDate of the EmployeeCredential.
+	ExpirationDate *time.Time
+}
+
+// Validate checks that all fields of the EmployeeCredential are set.
+func (e EmployeeDetails) Validate() error {
+	return e.builder().Validate()
 }
 
 func (e EmployeeDetails) Credentials() []vc.VerifiableCredential {
-	return []vc.VerifiableCredential{
-		{
-			Context: []ssi.URI{
-				ssi.MustParseURI("https://www.w3.org/2018/credentials/v1"),
-				ssi.MustParseURI("https://nuts.nl/credentials/v1"),
-			},
-			Type: []ssi.URI{
-				ssi.MustParseURI("VerifiableCredential"),
-				ssi.MustParseURI("EmployeeCredential"),
-			},
-			CredentialSubject: []interface{}{
-				map[string]interface{}{
-					"identifier": e.Id,
-					"name":       e.Name,
-					"roleName":   e.Role,
-				},
-			},
-		},
-	}
+	return e.builder().Credentials()
+}
+
+func (e EmployeeDetails) builder() CredentialBuilder {
+	result := NewCredentialBuilder(NutsCredentialsContext, "EmployeeCredential", map[string]interface{}{
+		"identifier": e.Id,
+		"name":       e.Name,
+		"roleName":   e.Role,
+	}, "identifier", "name", "roleName")
+	result.ExpirationDate = e.ExpirationDate
+	return result
 }
@@ -0,0 +1,223 @@
+package nuts
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	ssi "github.com/nuts-foundation/go-did"
+	"github.com/nuts-foundation/go-did/vc"
+	"github.com/nuts-foundation/go-nuts-client/nuts/iam"
+	"github.com/nuts-foundation/go-nuts-client/nuts/vcr"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// CredentialIssuance requests a Verifiable Credential from an external issuer using OpenID4VCI,
+// through the API of a local Nuts node. The credential is issued into the wallet of NutsSubject.
+// CredentialIssuance doesn't keep state itself: the state returned by Start is passed to FindCredential by the application,
+// so issuances can be started concurrently and finished by another application instance.
+type CredentialIssuance struct {
+	NutsSubject string
+	// NutsAPIURL is the base URL of the Nuts node API.
+	NutsAPIURL string
+	// NutsHttpClient is the HTTP client used to communicate with the Nuts node.
+	// If not set, http.DefaultClient is used.
+	NutsHttpClient *http.Client
+	// Issuer is the OAuth2 Authorization Server identifier of the credential issuer.
+	Issuer string
+	// CredentialType is the type of the requested credential, e.g. NutsOrganizationCredential.
+	CredentialType string
+	// Context contains the JSON-LD contexts that define the credential type.
+	// If not set, NutsCredentialsContext is used.
+	Context []ssi.URI
+	// RedirectURI is the URL of the calling application, to which the user-agent is redirected after the flow finished.
+	// The handler registered at this URL should be CallbackHandler.
+	RedirectURI string
+}
+
+// CredentialIssuanceState is the state of a started credential issuance.
+// The application keeps it (e.g. in the session of the user-agent) until the user-agent returns from the issuer.
+// It can be marshalled to JSON.
+type CredentialIssuanceState struct {
+	// Existing contains the keys of the credentials that were in the wallet when the issuance was started,
+	// so only a newly issued credential is accepted afterwards.
+	Existing []string `json:"existing"`
+}
+
+// AuthorizationDetails returns the OpenID4VCI authorization_details for the requested credential type (in ldp_vc format).
+func (c CredentialIssuance) AuthorizationDetails() []map[string]interface{} {
+	contexts := []interface{}{vc.VCContextV1URI().String()}
+	if len(c.Context) == 0 {
+		contexts = append(contexts, NutsCredentialsContext.String())
+	}
+	for _, context := range c.Context {
+		contexts = append(contexts, context.String())
+	}
+	return []map[string]interface{}{
+		{
+			"type":   "openid_credential",
+			"format": "ldp_vc",
+			"credential_definition": map[string]interface{}{
+				"@context": contexts,
+				"type":     []interface{}{vc.VerifiableCredentialTypeV1URI().String(), c.CredentialType},
+			},
+		},
+	}
+}
+
+// Start requests the issuance of the credential to the given wallet DID, which must be owned by NutsSubject.
+// The user-agent must be redirected to the returned redirect URI,
+// and the returned state must be passed to FindCredential when the user-agent returns.
+func (c CredentialIssuance) Start(ctx context.Context, walletDID string) (*iam.RedirectResponse, *CredentialIssuanceState, error) {
+	if c.NutsSubject == "" {
+		return nil, nil, errors.New("subject is required")
+	}
+	if c.Issuer == "" || c.CredentialType == "" {
+		return nil, nil, errors.New("issuer and credential type are required")
+	}
+	if _, err := c.credentialType(); err != nil {
+		return nil, nil, err
+	}
+	if c.RedirectURI == "" {
+		return nil, nil, errors.New("redirect URI is required")
+	}
+	credentials, err := c.walletCredentials(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	state := CredentialIssuanceState{Existing: make([]string, 0, len(credentials))}
+	for _, credential := range credentials {
+		state.Existing = append(state.Existing, credentialKey(credential))
+	}
+	client, err := newIAMClient(c.NutsAPIURL, c.NutsHttpClient)
+	if err != nil {
+		return nil, nil, err
+	}
+	httpResponse, err := client.RequestOpenid4VCICredentialIssuance(ctx, c.NutsSubject, iam.RequestOpenid4VCICredentialIssuanceJSONRequestBody{
+		AuthorizationDetails: c.AuthorizationDetails(),
+		Issuer:               c.Issuer,
+		RedirectUri:          c.RedirectURI,
+		WalletDid:            walletDID,
+	})
+	response, err := ParseResponse(err, httpResponse, iam.ParseRequestOpenid4VCICredentialIssuanceResponse)
+	if err != nil {
+		return nil, nil, fmt.Errorf("credential issuance request: %w", err)
+	}
+	if response.JSON200 == nil {
+		return nil, nil, fmt.Errorf("failed credential issuance response: %s", response.Status())
+	}
+	return response.JSON200, &state, nil
+}
+
+// FindCredential returns the most recently issued credential of the requested type in the wallet of NutsSubject,
+// that was issued by Issuer after the issuance was started with the given state (see Start),
+// or nil if the wallet doesn't contain such a credential.
+func (c CredentialIssuance) FindCredential(ctx context.Context, state CredentialIssuanceState) (*vc.VerifiableCredential, error) {
+	credentialType, err := c.credentialType()
+	if err != nil {
+		return nil, err
+	}
+	existing := make(map[string]bool, len(state.Existing))
+	for _, key := range state.Existing {
+		existing[key] = true
+	}
+	credentials, err := c.walletCredentials(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var result *vc.VerifiableCredential
+	for _, credential := range credentials {
+		if !credential.IsType(credentialType) || existing[credentialKey(credential)] || !c.issuedBy(credential) {
+			continue
+		}
+		if result == nil || credential.IssuanceDate.After(result.IssuanceDate) {
+			result = &credential
+		}
+	}
+	return result, nil
+}
+
+func (c CredentialIssuance) credentialType() (ssi.URI, error) {
+	credentialType, err := ssi.ParseURI(c.CredentialType)
+	if err != nil {
+		return ssi.URI{}, fmt.Errorf("invalid credential type %s: %w", c.CredentialType, err)
+	}
+	return *credentialType, nil
+}
+
+func (c CredentialIssuance) walletCredentials(ctx context.Context) ([]vc.VerifiableCredential, error) {
+	client, err := newVCRClient(c.NutsAPIURL, c.NutsHttpClient)
+	if err != nil {
+		return nil, err
+	}
+	httpResponse, err := client.GetCredentialsInWallet(ctx, c.NutsSubject)
+	response, err := ParseResponse(err, httpResponse, vcr.ParseGetCredentialsInWalletResponse)
+	if err != nil {
+		return nil, fmt.Errorf("wallet credentials: %w", err)
+	}
+	if response.JSON200 == nil {
+		return nil, fmt.Errorf("failed wallet credentials response: %s", response.Status())
+	}
+	return *response.JSON200, nil
+}
+
+// issuedBy checks whether the credential was issued by Issuer: either its identifier, or the did:web DID derived from it.
+func (c CredentialIssuance) issuedBy(credential vc.VerifiableCredential) bool {
+	issuer := credential.Issuer.String()
+	if issuer == c.Issuer {
+		return true
+	}
+	issuerURL, err := url.Parse(c.Issuer)
+	if err != nil || issuerURL.Scheme != "https" || issuerURL.Host == "" {
+		return false
+	}
+	didWeb := "did:web:" + strings.ReplaceAll(issuerURL.Host, ":", "%3A")
+	if path := strings.Trim(issuerURL.Path, "/"); path != "" {
+		didWeb += ":" + strings.ReplaceAll(path, "/", ":")
+	}
+	return issuer == didWeb
+}
+
+// credentialKey returns the ID of the credential, or the hash of its raw form if it doesn't have an ID.
+func credentialKey(credential vc.VerifiableCredential) string {
+	if credential.ID != nil {
+		return credential.ID.String()
+	}
+	hash := sha256.Sum256([]byte(credential.Raw()))
+	return base64.RawURLEncoding.EncodeToString(hash[:])
+}
+
+// CallbackHandler returns a handler that checks whether the credential was issued into the wallet,
+// when the user-agent returns from the issuer. If so, the next function is called with the credential.
+// The state function returns the state of the issuance that was started for the user-agent (see Start).
+func (c CredentialIssuance) CallbackHandler(state func(httpRequest *http.Request) (*CredentialIssuanceState, error),
+	next func(response http.ResponseWriter, httpRequest *http.Request, credential vc.VerifiableCredential)) http.Handler {
+	return http.HandlerFunc(func(response http.ResponseWriter, httpRequest *http.Request) {
+		if errorCode := httpRequest.URL.Query().Get("error"); errorCode != "" {
+			http.Error(response, fmt.Sprintf("credential issuance failed: %s %s", errorCode, httpRequest.URL.Query().Get("error_description")), http.StatusBadRequest)
+			return
+		}
+		issuanceState, err := state(httpRequest)
+		if err != nil {
+			http.Error(response, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if issuanceState == nil {
+			http.Error(response, "credential issuance not started", http.StatusBadRequest)
+			return
+		}
+		credential, err := c.FindCredential(httpRequest.Context(), *issuanceState)
+		if err != nil {
+			http.Error(response, err.Error(), http.StatusBadGateway)
+			return
+		}
+		if credential == nil {
+			http.Error(response, fmt.Sprintf("credential issuance failed: no %s in wallet", c.CredentialType), http.StatusBadGateway)
+			return
+		}
+		next(response, httpRequest, *credential)
+	})
+}
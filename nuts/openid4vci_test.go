@@ -0,0 +1,175 @@
+package nuts
+
+import (
+	"context"
+	"encoding/json"
+	ssi "github.com/nuts-foundation/go-did"
+	"github.com/nuts-foundation/go-did/vc"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestCredentialIssuance_Start(t *testing.T) {
+	t.Run("ok", func(t *testing.T) {
+		mux := http.NewServeMux()
+		var capturedRequest map[string]interface{}
+		mux.HandleFunc("GET /internal/vcr/v2/holder/123abc/vc", func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusOK)
+			_, _ = w.Write([]byte(`[]`))
+		})
+		mux.HandleFunc("POST /internal/auth/v2/123abc/request-credential", func(w http.ResponseWriter, r *http.Request) {
+			require.NoError(t, json.NewDecoder(r.Body).Decode(&capturedRequest))
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusOK)
+			_, _ = w.Write([]byte(`{"redirect_uri":"https://issuer.example.com/authorize"}`))
+		})
+		httpServer := httptest.NewServer(mux)
+		issuance := CredentialIssuance{
+			NutsSubject:    "123abc",
+			NutsAPIURL:     httpServer.URL,
+			Issuer:         "https://issuer.example.com",
+			CredentialType: "NutsOrganizationCredential",
+			RedirectURI:    "https://app.example.com/callback",
+		}
+
+		response, state, err := issuance.Start(context.Background(), "did:web:example.com")
+
+		require.NoError(t, err)
+		require.Equal(t, "https://issuer.example.com/authorize", response.RedirectUri)
+		require.Empty(t, state.Existing)
+		require.Equal(t, "did:web:example.com", capturedRequest["wallet_did"])
+		require.Equal(t, "https://issuer.example.com", capturedRequest["issuer"])
+		require.Equal(t, []interface{}{
+			map[string]interface{}{
+				"type":   "openid_credential",
+				"format": "ldp_vc",
+				"credential_definition": map[string]interface{}{
+					"@context": []interface{}{"https://www.w3.org/2018/credentials/v1", "https://nuts.nl/credentials/v1"},
+					"type":     []interface{}{"VerifiableCredential", "NutsOrganizationCredential"},
+				},
+			},
+		}, capturedRequest["authorization_details"])
+	})
+	t.Run("missing credential type", func(t *testing.T) {
+		issuance := CredentialIssuance{NutsSubject: "123abc", Issuer: "https://issuer.example.com"}
+
+		_, _, err := issuance.Start(context.Background(), "did:web:example.com")
+
+		require.EqualError(t, err, "issuer and credential type are required")
+	})
+	t.Run("invalid credential type", func(t *testing.T) {
+		issuance := CredentialIssuance{NutsSubject: "123abc", Issuer: "https://issuer.example.com", CredentialType: "Nuts%Credential", RedirectURI: "https://app.example.com/callback"}
+
+		_, _, err := issuance.Start(context.Background(), "did:web:example.com")
+
+		require.ErrorContains(t, err, "invalid credential type Nuts%Credential")
+	})
+}
+
+func TestCredentialIssuance_CallbackHandler(t *testing.T) {
+	const (
+		existingCredential = `{"@context":["https://www.w3.org/2018/credentials/v1"],"id":"did:web:issuer.example.com#1","type":["VerifiableCredential","NutsOrganizationCredential"],"issuer":"did:web:issuer.example.com","issuanceDate":"2024-01-01T00:00:00Z","credentialSubject":{}}`
+		issuedCredential   = `{"@context":["https://www.w3.org/2018/credentials/v1"],"id":"did:web:issuer.example.com#2","type":["VerifiableCredential","NutsOrganizationCredential"],"issuer":"did:web:issuer.example.com","issuanceDate":"2024-06-01T00:00:00Z","credentialSubject":{}}`
+		otherIssuer        = `{"@context":["https://www.w3.org/2018/credentials/v1"],"id":"did:web:other.example.com#3","type":["VerifiableCredential","NutsOrganizationCredential"],"issuer":"did:web:other.example.com","issuanceDate":"2024-09-01T00:00:00Z","credentialSubject":{}}`
+		otherType          = `{"@context":["https://www.w3.org/2018/credentials/v1"],"id":"did:web:issuer.example.com#4","type":["VerifiableCredential","EmployeeCredential"],"issuer":"did:web:issuer.example.com","issuanceDate":"2024-09-01T00:00:00Z","credentialSubject":{}}`
+	)
+	var wallet []string
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /internal/vcr/v2/holder/123abc/vc", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte("[" + strings.Join(wallet, ",") + "]"))
+	})
+	mux.HandleFunc("POST /internal/auth/v2/123abc/request-credential", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte(`{"redirect_uri":"https://issuer.example.com/authorize"}`))
+	})
+	httpServer := httptest.NewServer(mux)
+	issuance := CredentialIssuance{
+		NutsSubject:    "123abc",
+		NutsAPIURL:     httpServer.URL,
+		Issuer:         "https://issuer.example.com",
+		CredentialType: "NutsOrganizationCredential",
+		RedirectURI:    "https://app.example.com/callback",
+	}
+	// start starts the issuance with the given wallet, and returns the state function of the CallbackHandler.
+	start := func(t *testing.T, walletAtStart ...string) func(*http.Request) (*CredentialIssuanceState, error) {
+		wallet = walletAtStart
+		_, state, err := issuance.Start(context.Background(), "did:web:example.com")
+		require.NoError(t, err)
+		// The application keeps the state, e.g. in the session of the user-agent
+		data, err := json.Marshal(state)
+		require.NoError(t, err)
+		return func(_ *http.Request) (*CredentialIssuanceState, error) {
+			var result CredentialIssuanceState
+			return &result, json.Unmarshal(data, &result)
+		}
+	}
+	t.Run("ok", func(t *testing.T) {
+		state := start(t, existingCredential)
+		wallet = []string{existingCredential, issuedCredential, otherIssuer, otherType}
+		var capturedCredential vc.VerifiableCredential
+		handler := issuance.CallbackHandler(state, func(response http.ResponseWriter, httpRequest *http.Request, credential vc.VerifiableCredential) {
+			capturedCredential = credential
+			response.WriteHeader(http.StatusNoContent)
+		})
+		response := httptest.NewRecorder()
+
+		handler.ServeHTTP(response, httptest.NewRequest(http.MethodGet, "/callback", nil))
+
+		require.Equal(t, http.StatusNoContent, response.Code)
+		require.Equal(t, "did:web:issuer.example.com#2", capturedCredential.ID.String())
+	})
+	t.Run("only credential that was already in wallet", func(t *testing.T) {
+		state := start(t, existingCredential)
+		response := httptest.NewRecorder()
+
+		issuance.CallbackHandler(state, nil).ServeHTTP(response, httptest.NewRequest(http.MethodGet, "/callback", nil))
+
+		require.Equal(t, http.StatusBadGateway, response.Code)
+		require.Contains(t, response.Body.String(), "no NutsOrganizationCredential in wallet")
+	})
+	t.Run("only credential of other issuer", func(t *testing.T) {
+		state := start(t)
+		wallet = []string{otherIssuer}
+		response := httptest.NewRecorder()
+
+		issuance.CallbackHandler(state, nil).ServeHTTP(response, httptest.NewRequest(http.MethodGet, "/callback", nil))
+
+		require.Equal(t, http.StatusBadGateway, response.Code)
+		require.Contains(t, response.Body.String(), "no NutsOrganizationCredential in wallet")
+	})
+	t.Run("not started", func(t *testing.T) {
+		state := func(_ *http.Request) (*CredentialIssuanceState, error) {
+			return nil, nil
+		}
+		response := httptest.NewRecorder()
+
+		issuance.CallbackHandler(state, nil).ServeHTTP(response, httptest.NewRequest(http.MethodGet, "/callback", nil))
+
+		require.Equal(t, http.StatusBadRequest, response.Code)
+		require.Contains(t, response.Body.String(), "credential issuance not started")
+	})
+	t.Run("issuer returned error", func(t *testing.T) {
+		state := start(t)
+		response := httptest.NewRecorder()
+
+		issuance.CallbackHandler(state, nil).ServeHTTP(response, httptest.NewRequest(http.MethodGet, "/callback?error=access_denied", nil))
+
+		require.Equal(t, http.StatusBadRequest, response.Code)
+		require.Contains(t, response.Body.String(), "access_denied")
+	})
+}
+
+func TestCredentialIssuance_issuedBy(t *testing.T) {
+	issuance := CredentialIssuance{Issuer: "https://example.com:8443/iam/123"}
+
+	require.True(t, issuance.issuedBy(vc.VerifiableCredential{Issuer: ssi.MustParseURI("did:web:example.com%3A8443:iam:123")}))
+	require.True(t, issuance.issuedBy(vc.VerifiableCredential{Issuer: ssi.MustParseURI("https://example.com:8443/iam/123")}))
+	require.False(t, issuance.issuedBy(vc.VerifiableCredential{Issuer: ssi.MustParseURI("did:web:example.com:iam:123")}))
+}
@@ -0,0 +1,348 @@
+package pe
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/nuts-foundation/go-did/vc"
+	"reflect"
+	"regexp"
+	"slices"
+	"strings"
+	"unicode/utf8"
+)
+
+// Result is the result of matching credentials against a presentation definition.
+type Result struct {
+	// Satisfied indicates whether the credentials satisfy the presentation definition:
+	// all input descriptors are matched, or if the definition has submission requirements, those are met.
+	Satisfied bool
+	// Matches maps the IDs of the matched input descriptors to the credentials that satisfy them.
+	Matches map[string][]vc.VerifiableCredential
+	// Missing contains the input descriptors that aren't matched by any credential, in the order of the presentation definition.
+	Missing []MissingInputDescriptor
+}
+
+// MissingInputDescriptor is an input descriptor that isn't matched by any credential.
+type MissingInputDescriptor struct {
+	InputDescriptor InputDescriptor
+	// Reason describes why the input descriptor isn't matched, based on the credential that came closest.
+	Reason string
+}
+
+// Match matches the credentials (e.g. of a wallet) against the input descriptors of the presentation definition,
+// and evaluates its submission requirements. It can be used to check whether a presentation can be created
+// for the definition (e.g. when requesting an access token), and if not, why.
+// It returns an error if the presentation definition is invalid.
+func (d PresentationDefinition) Match(credentials []vc.VerifiableCredential) (*Result, error) {
+	documents := make([]map[string]interface{}, len(credentials))
+	for i, credential := range credentials {
+		document, err := CredentialDocument(credential)
+		if err != nil {
+			return nil, err
+		}
+		documents[i] = document
+	}
+	result := Result{Matches: make(map[string][]vc.VerifiableCredential)}
+	for _, descriptor := range d.InputDescriptors {
+		reason := "no credentials"
+		bestScore := -1
+		for i, credential := range credentials {
+			score, mismatch, err := d.matchCredential(descriptor, credential, documents[i])
+			if err != nil {
+				return nil, fmt.Errorf("input descriptor %s: %w", descriptor.ID, err)
+			}
+			if mismatch == "" {
+				result.Matches[descriptor.ID] = append(result.Matches[descriptor.ID], credential)
+			} else if score > bestScore {
+				bestScore = score
+				reason = mismatch
+			}
+		}
+		if len(result.Matches[descriptor.ID]) == 0 {
+			result.Missing = append(result.Missing, MissingInputDescriptor{InputDescriptor: descriptor, Reason: reason})
+		}
+	}
+	if len(d.SubmissionRequirements) == 0 {
+		result.Satisfied = len(result.Missing) == 0
+		return &result, nil
+	}
+	result.Satisfied = true
+	for _, requirement := range d.SubmissionRequirements {
+		satisfied, err := requirement.satisfied(d.InputDescriptors, result.Matches)
+		if err != nil {
+			return nil, err
+		}
+		result.Satisfied = result.Satisfied && satisfied
+	}
+	return &result, nil
+}
+
+// Match reports whether the credential satisfies the input descriptor's format and constraints.
+func (d InputDescriptor) Match(credential vc.VerifiableCredential) (bool, error) {
+	document, err := CredentialDocument(credential)
+	if err != nil {
+		return false, err
+	}
+	_, mismatch, err := PresentationDefinition{}.matchCredential(d, credential, document)
+	return err == nil && mismatch == "", err
+}
+
+// ExtractFields returns the values of the input descriptor's fields that have an ID, keyed by field ID.
+// Fields that can't be resolved are omitted.
+func (d InputDescriptor) ExtractFields(credential vc.VerifiableCredential) (map[string]interface{}, error) {
+	document, err := CredentialDocument(credential)
+	if err != nil {
+		return nil, err
+	}
+	result := make(map[string]interface{})
+	for _, field := range d.Constraints.Fields {
+		if field.ID == "" {
+			continue
+		}
+		value, _, err := field.resolve(document)
+		if err != nil {
+			return nil, err
+		}
+		if value != nil {
+			result[field.ID] = value
+		}
+	}
+	return result, nil
+}
+
+// matchCredential matches the credential against the input descriptor. If it doesn't match, the reason is returned,
+// along with the number of fields that did match (the score), to find the credential that came closest.
+func (d PresentationDefinition) matchCredential(descriptor InputDescriptor, credential vc.VerifiableCredential, document map[string]interface{}) (int, string, error) {
+	score := 0
+	for _, field := range descriptor.Constraints.Fields {
+		if field.Optional {
+			continue
+		}
+		value, matched, err := field.resolve(document)
+		if err != nil {
+			return 0, "", err
+		}
+		if value == nil {
+			return score, fmt.Sprintf("field %s is missing", field.name()), nil
+		}
+		if !matched {
+			return score, fmt.Sprintf("field %s does not match the filter", field.name()), nil
+		}
+		score++
+	}
+	format := d.Format
+	if descriptor.Format != nil {
+		format = descriptor.Format
+	}
+	if !format.supportsCredential(credential) {
+		return score, fmt.Sprintf("credential format %s is not supported", credentialFormat(credential)), nil
+	}
+	return score, "", nil
+}
+
+// resolve returns the value selected by the first path of the field that resolves, and whether it matches the filter.
+// If a path selects multiple values, the first value that matches the filter is returned.
+func (f Field) resolve(document map[string]interface{}) (interface{}, bool, error) {
+	for _, path := range f.Path {
+		values, err := ResolveJSONPath(document, path)
+		if err != nil {
+			return nil, false, err
+		}
+		if len(values) == 0 {
+			continue
+		}
+		if f.Filter == nil {
+			return values[0], true, nil
+		}
+		for _, value := range values {
+			matched, err := f.Filter.Match(value)
+			if err != nil {
+				return nil, false, err
+			}
+			if matched {
+				return value, true, nil
+			}
+		}
+		return values[0], false, nil
+	}
+	return nil, false, nil
+}
+
+func (f Field) name() string {
+	if f.ID != "" {
+		return f.ID
+	}
+	return strings.Join(f.Path, ", ")
+}
+
+// Match reports whether the value matches the filter.
+// If the value is an array and the filter doesn't apply to arrays, it matches if any of its items match
+// (e.g. to match the type of a credential).
+func (f Filter) Match(value interface{}) (bool, error) {
+	if list, ok := value.([]interface{}); ok && f.Type != "array" && f.Contains == nil {
+		for _, item := range list {
+			if matched, err := f.Match(item); matched || err != nil {
+				return matched, err
+			}
+		}
+		return false, nil
+	}
+	if f.Type != "" && !matchesType(f.Type, value) {
+		return false, nil
+	}
+	if f.Const != nil && !reflect.DeepEqual(f.Const, value) {
+		return false, nil
+	}
+	if len(f.Enum) > 0 && !slices.ContainsFunc(f.Enum, func(curr interface{}) bool {
+		return reflect.DeepEqual(curr, value)
+	}) {
+		return false, nil
+	}
+	if str, ok := value.(string); ok {
+		if f.Pattern != "" {
+			pattern, err := regexp.Compile(f.Pattern)
+			if err != nil {
+				return false, fmt.Errorf("invalid filter pattern: %w", err)
+			}
+			if !pattern.MatchString(str) {
+				return false, nil
+			}
+		}
+		length := utf8.RuneCountInString(str)
+		if (f.MinLength != nil && length < *f.MinLength) || (f.MaxLength != nil && length > *f.MaxLength) {
+			return false, nil
+		}
+	} else if f.Pattern != "" || f.MinLength != nil || f.MaxLength != nil {
+		return false, nil
+	}
+	if number, ok := value.(float64); ok {
+		if (f.Minimum != nil && number < *f.Minimum) || (f.Maximum != nil && number > *f.Maximum) ||
+			(f.ExclusiveMinimum != nil && number <= *f.ExclusiveMinimum) || (f.ExclusiveMaximum != nil && number >= *f.ExclusiveMaximum) {
+			return false, nil
+		}
+	} else if f.Minimum != nil || f.Maximum != nil || f.ExclusiveMinimum != nil || f.ExclusiveMaximum != nil {
+		return false, nil
+	}
+	if f.Contains != nil {
+		list, ok := value.([]interface{})
+		if !ok {
+			return false, nil
+		}
+		for _, item := range list {
+			if matched, err := f.Contains.Match(item); matched || err != nil {
+				return matched, err
+			}
+		}
+		return false, nil
+	}
+	return true, nil
+}
+
+func matchesType(filterType string, value interface{}) bool {
+	switch filterType {
+	case "string":
+		_, ok := value.(string)
+		return ok
+	case "number":
+		_, ok := value.(float64)
+		return ok
+	case "integer":
+		number, ok := value.(float64)
+		return ok && number == float64(int64(number))
+	case "boolean":
+		_, ok := value.(bool)
+		return ok
+	case "array":
+		_, ok := value.([]interface{})
+		return ok
+	case "object":
+		_, ok := value.(map[string]interface{})
+		return ok
+	case "null":
+		return value == nil
+	default:
+		return false
+	}
+}
+
+// satisfied reports whether the matched input descriptors meet the submission requirement.
+func (r SubmissionRequirement) satisfied(descriptors []InputDescriptor, matches map[string][]vc.VerifiableCredential) (bool, error) {
+	var total, satisfied int
+	switch {
+	case r.From != "":
+		for _, descriptor := range descriptors {
+			if slices.Contains(descriptor.Group, r.From) {
+				total++
+				if len(matches[descriptor.ID]) > 0 {
+					satisfied++
+				}
+			}
+		}
+	case len(r.FromNested) > 0:
+		for _, nested := range r.FromNested {
+			total++
+			ok, err := nested.satisfied(descriptors, matches)
+			if err != nil {
+				return false, err
+			}
+			if ok {
+				satisfied++
+			}
+		}
+	default:
+		return false, errors.New("submission requirement must specify from or from_nested")
+	}
+	switch r.Rule {
+	case "all":
+		return satisfied == total, nil
+	case "pick":
+		if r.Count != nil {
+			return satisfied >= *r.Count, nil
+		}
+		return r.Min == nil || satisfied >= *r.Min, nil
+	default:
+		return false, fmt.Errorf("unsupported submission requirement rule: %s", r.Rule)
+	}
+}
+
+// supportsCredential reports whether the format allows the credential's format.
+// Only credential formats (e.g. ldp_vc and jwt_vc) are considered, if none are specified all credentials are allowed.
+func (f Format) supportsCredential(credential vc.VerifiableCredential) bool {
+	var specified bool
+	for format := range f {
+		if strings.HasSuffix(format, "_vc") {
+			specified = true
+			if format == credentialFormat(credential) {
+				return true
+			}
+		}
+	}
+	return !specified
+}
+
+func credentialFormat(credential vc.VerifiableCredential) string {
+	if credential.Format() == vc.JWTCredentialProofFormat {
+		return vc.JWTCredentialProofFormat
+	}
+	return vc.JSONLDCredentialProofFormat
+}
+
+// CredentialDocument returns the credential in its JSON-LD form as generic map, regardless of its format (JSON-LD or JWT),
+// to resolve JSONPath expressions against. A single credentialSubject is unwrapped, as done for JSON-LD credentials.
+func CredentialDocument(credential vc.VerifiableCredential) (map[string]interface{}, error) {
+	// Use an alias type, since JWT credentials otherwise marshal to the JWT
+	type alias vc.VerifiableCredential
+	data, err := json.Marshal(alias(credential))
+	if err != nil {
+		return nil, err
+	}
+	var result map[string]interface{}
+	if err := json.Unmarshal(data, &result); err != nil {
+		return nil, err
+	}
+	if subjects, ok := result["credentialSubject"].([]interface{}); ok && len(subjects) == 1 {
+		result["credentialSubject"] = subjects[0]
+	}
+	return result, nil
+}
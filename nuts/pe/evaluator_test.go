@@ -0,0 +1,262 @@
+package pe
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"github.com/nuts-foundation/go-did/vc"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+const organizationCredential = `{
+  "@context": ["https://www.w3.org/2018/credentials/v1", "https://nuts.nl/credentials/v1"],
+  "type": ["VerifiableCredential", "NutsOrganizationCredential"],
+  "issuer": "did:web:example.com:iam:issuer",
+  "issuanceDate": "2024-01-01T00:00:00Z",
+  "credentialSubject": {"id": "did:web:example.com:iam:holder", "organization": {"name": "Hospital", "city": "Amsterdam"}}
+}`
+
+const uraCredential = `{
+  "@context": ["https://www.w3.org/2018/credentials/v1", "https://nuts.nl/credentials/v1"],
+  "type": ["VerifiableCredential", "NutsUraCredential"],
+  "issuer": "did:web:example.com:iam:issuer",
+  "issuanceDate": "2024-01-01T00:00:00Z",
+  "credentialSubject": {"id": "did:web:example.com:iam:holder", "organization": {"ura": "1234", "name": "Hospital"}}
+}`
+
+const presentationDefinition = `{
+  "id": "pd",
+  "input_descriptors": [
+    {
+      "id": "organization",
+      "constraints": {
+        "fields": [
+          {"path": ["$.type"], "filter": {"type": "string", "const": "NutsOrganizationCredential"}},
+          {"id": "organization_name", "path": ["$.credentialSubject.organization.name"], "filter": {"type": "string"}},
+          {"id": "organization_city", "path": ["$.credentialSubject.organization.city"], "filter": {"type": "string", "pattern": "^Amster"}},
+          {"id": "organization_phone", "path": ["$.credentialSubject.organization.phone"], "optional": true}
+        ]
+      }
+    },
+    {
+      "id": "ura",
+      "constraints": {
+        "fields": [
+          {"path": ["$.type"], "filter": {"type": "string", "const": "NutsUraCredential"}},
+          {"id": "organization_ura", "path": ["$.credentialSubject.organization.ura"], "filter": {"type": "string", "minLength": 4}}
+        ]
+      }
+    }
+  ]
+}`
+
+func parseCredential(t *testing.T, data string) vc.VerifiableCredential {
+	result, err := vc.ParseVerifiableCredential(data)
+	require.NoError(t, err)
+	return *result
+}
+
+func parseDefinition(t *testing.T, data string) PresentationDefinition {
+	var result map[string]interface{}
+	require.NoError(t, json.Unmarshal([]byte(data), &result))
+	definition, err := ParsePresentationDefinition(result)
+	require.NoError(t, err)
+	return *definition
+}
+
+func TestPresentationDefinition_Match(t *testing.T) {
+	organization := parseCredential(t, organizationCredential)
+	ura := parseCredential(t, uraCredential)
+
+	t.Run("satisfied", func(t *testing.T) {
+		result, err := parseDefinition(t, presentationDefinition).Match([]vc.VerifiableCredential{ura, organization})
+
+		require.NoError(t, err)
+		require.True(t, result.Satisfied)
+		require.Empty(t, result.Missing)
+		require.Equal(t, map[string][]vc.VerifiableCredential{
+			"organization": {organization},
+			"ura":          {ura},
+		}, result.Matches)
+	})
+	t.Run("missing credential", func(t *testing.T) {
+		result, err := parseDefinition(t, presentationDefinition).Match([]vc.VerifiableCredential{organization})
+
+		require.NoError(t, err)
+		require.False(t, result.Satisfied)
+		require.Len(t, result.Missing, 1)
+		require.Equal(t, "ura", result.Missing[0].InputDescriptor.ID)
+		require.Equal(t, "field $.type does not match the filter", result.Missing[0].Reason)
+	})
+	t.Run("no credentials", func(t *testing.T) {
+		result, err := parseDefinition(t, presentationDefinition).Match(nil)
+
+		require.NoError(t, err)
+		require.False(t, result.Satisfied)
+		require.Len(t, result.Missing, 2)
+		require.Equal(t, "no credentials", result.Missing[0].Reason)
+	})
+	t.Run("reason of closest credential", func(t *testing.T) {
+		definition := parseDefinition(t, presentationDefinition)
+		definition.InputDescriptors[1].Constraints.Fields[1].Filter.MinLength = new(int)
+		*definition.InputDescriptors[1].Constraints.Fields[1].Filter.MinLength = 5
+
+		result, err := definition.Match([]vc.VerifiableCredential{organization, ura})
+
+		require.NoError(t, err)
+		require.False(t, result.Satisfied)
+		require.Equal(t, "field organization_ura does not match the filter", result.Missing[0].Reason)
+	})
+	t.Run("missing field", func(t *testing.T) {
+		definition := parseDefinition(t, presentationDefinition)
+		definition.InputDescriptors[1].Constraints.Fields[1].Path = []string{"$.credentialSubject.organization.agb"}
+
+		result, err := definition.Match([]vc.VerifiableCredential{ura})
+
+		require.NoError(t, err)
+		require.Equal(t, "field organization_ura is missing", result.Missing[1].Reason)
+	})
+	t.Run("format", func(t *testing.T) {
+		jwtCredential := parseCredential(t, createJWTCredential(t, uraCredential))
+		definition := parseDefinition(t, presentationDefinition)
+		definition.Format = Format{"ldp_vc": {"proof_type": {"JsonWebSignature2020"}}, "jwt_vp": {"alg": {"ES256"}}}
+
+		result, err := definition.Match([]vc.VerifiableCredential{organization, jwtCredential})
+		require.NoError(t, err)
+		require.False(t, result.Satisfied)
+		require.Equal(t, "credential format jwt_vc is not supported", result.Missing[0].Reason)
+
+		definition.InputDescriptors[1].Format = Format{"jwt_vc": {"alg": {"ES256"}}}
+		result, err = definition.Match([]vc.VerifiableCredential{organization, jwtCredential})
+		require.NoError(t, err)
+		require.True(t, result.Satisfied)
+	})
+	t.Run("invalid pattern", func(t *testing.T) {
+		definition := parseDefinition(t, presentationDefinition)
+		definition.InputDescriptors[0].Constraints.Fields[2].Filter.Pattern = "("
+
+		_, err := definition.Match([]vc.VerifiableCredential{organization})
+
+		require.ErrorContains(t, err, "input descriptor organization: invalid filter pattern")
+	})
+	t.Run("submission requirements", func(t *testing.T) {
+		definition := parseDefinition(t, presentationDefinition)
+		definition.InputDescriptors[0].Group = []string{"A"}
+		definition.InputDescriptors[1].Group = []string{"A"}
+		one := 1
+		two := 2
+		definition.SubmissionRequirements = []SubmissionRequirement{{Rule: "pick", Count: &one, From: "A"}}
+
+		result, err := definition.Match([]vc.VerifiableCredential{organization})
+		require.NoError(t, err)
+		require.True(t, result.Satisfied)
+		require.Len(t, result.Missing, 1)
+
+		definition.SubmissionRequirements = []SubmissionRequirement{{Rule: "pick", Min: &two, From: "A"}}
+		result, err = definition.Match([]vc.VerifiableCredential{organization})
+		require.NoError(t, err)
+		require.False(t, result.Satisfied)
+
+		definition.SubmissionRequirements = []SubmissionRequirement{{Rule: "all", FromNested: []SubmissionRequirement{{Rule: "all", From: "A"}}}}
+		result, err = definition.Match([]vc.VerifiableCredential{organization, ura})
+		require.NoError(t, err)
+		require.True(t, result.Satisfied)
+
+		definition.SubmissionRequirements = []SubmissionRequirement{{Rule: "any", From: "A"}}
+		_, err = definition.Match([]vc.VerifiableCredential{organization})
+		require.EqualError(t, err, "unsupported submission requirement rule: any")
+
+		definition.SubmissionRequirements = []SubmissionRequirement{{Rule: "all"}}
+		_, err = definition.Match([]vc.VerifiableCredential{organization})
+		require.EqualError(t, err, "submission requirement must specify from or from_nested")
+	})
+}
+
+func TestInputDescriptor_ExtractFields(t *testing.T) {
+	definition := parseDefinition(t, presentationDefinition)
+
+	fields, err := definition.InputDescriptors[0].ExtractFields(parseCredential(t, organizationCredential))
+
+	require.NoError(t, err)
+	require.Equal(t, map[string]interface{}{"organization_name": "Hospital", "organization_city": "Amsterdam"}, fields)
+}
+
+func TestInputDescriptor_Match(t *testing.T) {
+	definition := parseDefinition(t, presentationDefinition)
+
+	matched, err := definition.InputDescriptors[0].Match(parseCredential(t, organizationCredential))
+	require.NoError(t, err)
+	require.True(t, matched)
+
+	matched, err = definition.InputDescriptors[0].Match(parseCredential(t, uraCredential))
+	require.NoError(t, err)
+	require.False(t, matched)
+}
+
+func TestFilter_Match(t *testing.T) {
+	number := func(value float64) *float64 {
+		return &value
+	}
+	testCases := []struct {
+		name     string
+		filter   Filter
+		value    interface{}
+		expected bool
+	}{
+		{"type string", Filter{Type: "string"}, "a", true},
+		{"type string mismatch", Filter{Type: "string"}, 1.0, false},
+		{"type integer", Filter{Type: "integer"}, 1.0, true},
+		{"type integer mismatch", Filter{Type: "integer"}, 1.5, false},
+		{"type boolean", Filter{Type: "boolean"}, true, true},
+		{"type object", Filter{Type: "object"}, map[string]interface{}{}, true},
+		{"unknown type", Filter{Type: "date"}, "2024-01-01", false},
+		{"const", Filter{Const: "a"}, "a", true},
+		{"const mismatch", Filter{Const: "a"}, "b", false},
+		{"enum", Filter{Enum: []interface{}{"a", "b"}}, "b", true},
+		{"enum mismatch", Filter{Enum: []interface{}{"a", "b"}}, "c", false},
+		{"pattern on number", Filter{Pattern: "1"}, 1.0, false},
+		{"maxLength", Filter{MaxLength: new(int)}, "a", false},
+		{"minimum", Filter{Minimum: number(1)}, 1.0, true},
+		{"exclusiveMinimum", Filter{ExclusiveMinimum: number(1)}, 1.0, false},
+		{"maximum on string", Filter{Maximum: number(1)}, "1", false},
+		{"any item of array", Filter{Type: "string", Const: "b"}, []interface{}{"a", "b"}, true},
+		{"array", Filter{Type: "array"}, []interface{}{"a"}, true},
+		{"contains", Filter{Type: "array", Contains: &Filter{Const: "b"}}, []interface{}{"a", "b"}, true},
+		{"contains mismatch", Filter{Contains: &Filter{Const: "c"}}, []interface{}{"a", "b"}, false},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			actual, err := testCase.filter.Match(testCase.value)
+
+			require.NoError(t, err)
+			require.Equal(t, testCase.expected, actual)
+		})
+	}
+}
+
+func TestParsePresentationSubmission(t *testing.T) {
+	submission, err := ParsePresentationSubmission(map[string]interface{}{
+		"id":            "1",
+		"definition_id": "pd",
+		"descriptor_map": []interface{}{
+			map[string]interface{}{"id": "ura", "format": "ldp_vp", "path": "$[0]", "path_nested": map[string]interface{}{"format": "ldp_vc", "path": "$.verifiableCredential[0]"}},
+		},
+	})
+
+	require.NoError(t, err)
+	require.Equal(t, "pd", submission.DefinitionID)
+	require.Equal(t, "$.verifiableCredential[0]", submission.DescriptorMap[0].PathNested.Path)
+}
+
+// createJWTCredential returns the credential in JWT format. The JWT isn't signed, since it's only parsed.
+func createJWTCredential(t *testing.T, credential string) string {
+	var claims map[string]interface{}
+	require.NoError(t, json.Unmarshal([]byte(credential), &claims))
+	payload, err := json.Marshal(map[string]interface{}{
+		"iss": claims["issuer"],
+		"sub": "did:web:example.com:iam:holder",
+		"vc":  claims,
+	})
+	require.NoError(t, err)
+	return base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"ES256"}`)) + "." + base64.RawURLEncoding.EncodeToString(payload) + ".c2lnbmF0dXJl"
+}
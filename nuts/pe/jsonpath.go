@@ -0,0 +1,86 @@
+package pe
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ResolveJSONPath resolves a JSONPath expression against a JSON document (as unmarshalled into interface{}),
+// and returns the values it selects. It supports the subset of JSONPath used in presentation definitions:
+// the root ($), child members (.name and ['name']), array indices ([0]) and wildcards (.* and [*]).
+func ResolveJSONPath(document interface{}, jsonPath string) ([]interface{}, error) {
+	remainder, ok := strings.CutPrefix(jsonPath, "$")
+	if !ok {
+		return nil, fmt.Errorf("invalid JSONPath %s: must start with $", jsonPath)
+	}
+	current := []interface{}{document}
+	for remainder != "" {
+		var selector string
+		var wildcard bool
+		var index = -1
+		switch {
+		case strings.HasPrefix(remainder, "['"):
+			end := strings.Index(remainder, "']")
+			if end < 0 {
+				return nil, fmt.Errorf("invalid JSONPath %s: unterminated member", jsonPath)
+			}
+			selector, remainder = remainder[2:end], remainder[end+2:]
+		case strings.HasPrefix(remainder, "["):
+			end := strings.Index(remainder, "]")
+			if end < 0 {
+				return nil, fmt.Errorf("invalid JSONPath %s: unterminated index", jsonPath)
+			}
+			if remainder[1:end] == "*" {
+				wildcard = true
+			} else {
+				var err error
+				if index, err = strconv.Atoi(remainder[1:end]); err != nil || index < 0 {
+					return nil, fmt.Errorf("invalid JSONPath %s: unsupported index %s", jsonPath, remainder[1:end])
+				}
+			}
+			remainder = remainder[end+1:]
+		case strings.HasPrefix(remainder, ".."):
+			return nil, fmt.Errorf("invalid JSONPath %s: recursive descent is not supported", jsonPath)
+		case strings.HasPrefix(remainder, "."):
+			end := strings.IndexAny(remainder[1:], ".[")
+			if end < 0 {
+				end = len(remainder) - 1
+			}
+			selector, remainder = remainder[1:end+1], remainder[end+1:]
+			if selector == "" {
+				return nil, fmt.Errorf("invalid JSONPath %s: empty member", jsonPath)
+			}
+			wildcard = selector == "*"
+		default:
+			return nil, fmt.Errorf("invalid JSONPath %s: unexpected %s", jsonPath, remainder)
+		}
+		var next []interface{}
+		for _, value := range current {
+			switch value := value.(type) {
+			case map[string]interface{}:
+				if wildcard {
+					keys := make([]string, 0, len(value))
+					for key := range value {
+						keys = append(keys, key)
+					}
+					sort.Strings(keys)
+					for _, key := range keys {
+						next = append(next, value[key])
+					}
+				} else if child, ok := value[selector]; ok && index < 0 {
+					next = append(next, child)
+				}
+			case []interface{}:
+				if wildcard {
+					next = append(next, value...)
+				} else if index >= 0 && index < len(value) {
+					next = append(next, value[index])
+				}
+			}
+		}
+		current = next
+	}
+	return current, nil
+}
@@ -0,0 +1,45 @@
+package pe
+
+import (
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestResolveJSONPath(t *testing.T) {
+	document := map[string]interface{}{
+		"a": map[string]interface{}{
+			"b": []interface{}{"c", "d"},
+			"e": "f",
+		},
+	}
+	testCases := []struct {
+		path     string
+		expected []interface{}
+	}{
+		{"$", []interface{}{document}},
+		{"$.a.b[1]", []interface{}{"d"}},
+		{"$['a']['b'][0]", []interface{}{"c"}},
+		{"$.a.b[*]", []interface{}{"c", "d"}},
+		{"$.a.*", []interface{}{[]interface{}{"c", "d"}, "f"}},
+		{"$.*.e", []interface{}{"f"}},
+		{"$.a.b[2]", nil},
+		{"$.a.c", nil},
+		{"$.a.e.f", nil},
+		{"$.a[0]", nil},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.path, func(t *testing.T) {
+			actual, err := ResolveJSONPath(document, testCase.path)
+
+			require.NoError(t, err)
+			require.Equal(t, testCase.expected, actual)
+		})
+	}
+	t.Run("invalid", func(t *testing.T) {
+		for _, path := range []string{"a.b", "$..a", "$.a[", "$['a'", "$.a[-1]", "$.", "$a"} {
+			_, err := ResolveJSONPath(document, path)
+
+			require.ErrorContains(t, err, "invalid JSONPath "+path, path)
+		}
+	})
+}
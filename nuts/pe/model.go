@@ -0,0 +1,119 @@
+// Package pe provides typed models of Presentation Exchange v2 (https://identity.foundation/presentation-exchange/spec/v2.0.0/),
+// and an evaluator that matches Verifiable Credentials against Presentation Definitions.
+package pe
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// PresentationDefinition describes the Verifiable Credentials a verifier requires.
+type PresentationDefinition struct {
+	ID                     string                  `json:"id"`
+	Name                   string                  `json:"name,omitempty"`
+	Purpose                string                  `json:"purpose,omitempty"`
+	Format                 Format                  `json:"format,omitempty"`
+	InputDescriptors       []InputDescriptor       `json:"input_descriptors"`
+	SubmissionRequirements []SubmissionRequirement `json:"submission_requirements,omitempty"`
+}
+
+// Format maps the supported credential and presentation formats (e.g. ldp_vc, jwt_vc) to their algorithms or proof types.
+type Format map[string]map[string][]string
+
+// InputDescriptor describes a single credential the verifier requires.
+type InputDescriptor struct {
+	ID          string      `json:"id"`
+	Name        string      `json:"name,omitempty"`
+	Purpose     string      `json:"purpose,omitempty"`
+	Format      Format      `json:"format,omitempty"`
+	Group       []string    `json:"group,omitempty"`
+	Constraints Constraints `json:"constraints"`
+}
+
+// Constraints contains the fields a credential must contain to satisfy an input descriptor.
+type Constraints struct {
+	Fields          []Field `json:"fields,omitempty"`
+	LimitDisclosure string  `json:"limit_disclosure,omitempty"`
+}
+
+// Field selects a value of a credential with JSONPath expressions (the first that resolves is used),
+// and optionally restricts it with a filter.
+type Field struct {
+	ID       string   `json:"id,omitempty"`
+	Name     string   `json:"name,omitempty"`
+	Purpose  string   `json:"purpose,omitempty"`
+	Path     []string `json:"path"`
+	Filter   *Filter  `json:"filter,omitempty"`
+	Optional bool     `json:"optional,omitempty"`
+}
+
+// Filter is the subset of JSON Schema used to restrict the value of a field.
+type Filter struct {
+	Type             string        `json:"type,omitempty"`
+	Const            interface{}   `json:"const,omitempty"`
+	Enum             []interface{} `json:"enum,omitempty"`
+	Pattern          string        `json:"pattern,omitempty"`
+	MinLength        *int          `json:"minLength,omitempty"`
+	MaxLength        *int          `json:"maxLength,omitempty"`
+	Minimum          *float64      `json:"minimum,omitempty"`
+	Maximum          *float64      `json:"maximum,omitempty"`
+	ExclusiveMinimum *float64      `json:"exclusiveMinimum,omitempty"`
+	ExclusiveMaximum *float64      `json:"exclusiveMaximum,omitempty"`
+	Contains         *Filter       `json:"contains,omitempty"`
+}
+
+// SubmissionRequirement specifies which combinations of input descriptors satisfy the presentation definition.
+// It refers to input descriptors through their group (From), or to nested submission requirements (FromNested).
+type SubmissionRequirement struct {
+	Name       string                  `json:"name,omitempty"`
+	Purpose    string                  `json:"purpose,omitempty"`
+	Rule       string                  `json:"rule"`
+	Count      *int                    `json:"count,omitempty"`
+	Min        *int                    `json:"min,omitempty"`
+	Max        *int                    `json:"max,omitempty"`
+	From       string                  `json:"from,omitempty"`
+	FromNested []SubmissionRequirement `json:"from_nested,omitempty"`
+}
+
+// PresentationSubmission describes how the credentials of a presentation map to the input descriptors of a presentation definition.
+type PresentationSubmission struct {
+	ID            string                         `json:"id"`
+	DefinitionID  string                         `json:"definition_id"`
+	DescriptorMap []InputDescriptorMappingObject `json:"descriptor_map"`
+}
+
+// InputDescriptorMappingObject points to the credential (Path, relative to the presentation) submitted for an input descriptor.
+// If the submission consists of multiple presentations, Path points to the presentation and PathNested to the credential in it.
+type InputDescriptorMappingObject struct {
+	ID         string                        `json:"id"`
+	Format     string                        `json:"format"`
+	Path       string                        `json:"path"`
+	PathNested *InputDescriptorMappingObject `json:"path_nested,omitempty"`
+}
+
+// ParsePresentationDefinition converts an untyped presentation definition (e.g. iam.PresentationDefinition or
+// discovery.ServiceDefinition.PresentationDefinition) into a PresentationDefinition.
+func ParsePresentationDefinition(data map[string]interface{}) (*PresentationDefinition, error) {
+	var result PresentationDefinition
+	if err := convert(data, &result); err != nil {
+		return nil, fmt.Errorf("invalid presentation definition: %w", err)
+	}
+	return &result, nil
+}
+
+// ParsePresentationSubmission converts an untyped presentation submission (e.g. iam.PresentationSubmission) into a PresentationSubmission.
+func ParsePresentationSubmission(data map[string]interface{}) (*PresentationSubmission, error) {
+	var result PresentationSubmission
+	if err := convert(data, &result); err != nil {
+		return nil, fmt.Errorf("invalid presentation submission: %w", err)
+	}
+	return &result, nil
+}
+
+func convert(source interface{}, target interface{}) error {
+	data, err := json.Marshal(source)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, target)
+}
@@ -0,0 +1,208 @@
+package nuts
+
+import (
+	"errors"
+	"fmt"
+	"github.com/nuts-foundation/go-nuts-client/nuts/iam"
+	"github.com/nuts-foundation/go-nuts-client/oauth2"
+	"gopkg.in/yaml.v3"
+	"io"
+	"log/slog"
+	"net/http"
+	"path"
+	"slices"
+	"strings"
+)
+
+// AuthorizationPolicy authorizes requests to a resource server based on their introspected access token.
+// Rules are evaluated in order, the first rule that matches the request's path and method is applied.
+// Requests that don't match any rule are denied.
+type AuthorizationPolicy struct {
+	Rules []AuthorizationRule `yaml:"rules"`
+	// ResourceMetadataURL is the URL of the protected resource metadata, which is advertised in the WWW-Authenticate challenge.
+	ResourceMetadataURL string `yaml:"resource_metadata_url"`
+	// Logger is used to log the authorization decisions. If not set, slog.Default() is used.
+	Logger *slog.Logger `yaml:"-"`
+}
+
+// AuthorizationRule specifies the requirements for requests to a route.
+type AuthorizationRule struct {
+	// Path is the route pattern. A path segment of * matches any single segment, and a trailing /** matches any (or no) subpath.
+	Path string `yaml:"path"`
+	// Methods contains the HTTP methods the rule applies to. If empty, it applies to all methods.
+	Methods []string `yaml:"methods"`
+	// Scopes contains the scopes the access token must have been granted (all of them).
+	Scopes []string `yaml:"scopes"`
+	// Clients contains the client DIDs allowed to access the route. If empty, all clients are allowed.
+	Clients []string `yaml:"clients"`
+	// Fields contains the introspection fields (from the credentials presented to obtain the access token) that must be present.
+	// If a value is given, the field must be equal to it.
+	Fields map[string]string `yaml:"fields"`
+}
+
+// AuthorizationDecision is the result of evaluating an AuthorizationPolicy for a request.
+type AuthorizationDecision struct {
+	// Allowed indicates whether the request is authorized.
+	Allowed bool
+	// Rule is the rule that matched the request, or nil if no rule matched.
+	Rule *AuthorizationRule
+	// Reason describes why the request was denied.
+	Reason string
+}
+
+// LoadAuthorizationPolicy reads an AuthorizationPolicy in YAML form, e.g.:
+//
+//	rules:
+//	  - path: /fhir/Patient/**
+//	    methods: [GET]
+//	    scopes: [patient-read]
+//	    fields:
+//	      organization_ura: ""
+func LoadAuthorizationPolicy(reader io.Reader) (*AuthorizationPolicy, error) {
+	var result AuthorizationPolicy
+	decoder := yaml.NewDecoder(reader)
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&result); err != nil {
+		return nil, fmt.Errorf("authorization policy: %w", err)
+	}
+	for i, rule := range result.Rules {
+		if !strings.HasPrefix(rule.Path, "/") {
+			return nil, fmt.Errorf("authorization policy: rule %d: path must start with /", i)
+		}
+		if _, err := path.Match(rule.Path, "/"); err != nil {
+			return nil, fmt.Errorf("authorization policy: rule %d: %w", i, err)
+		}
+	}
+	return &result, nil
+}
+
+// Evaluate decides whether the request is authorized, given its introspected access token.
+// Requests with dot segments (. or ..) in their path are denied, since the path they resolve to may not match the rule.
+func (p AuthorizationPolicy) Evaluate(httpRequest *http.Request, introspection *iam.TokenIntrospectionResponse) AuthorizationDecision {
+	if slices.ContainsFunc(strings.Split(httpRequest.URL.Path, "/"), func(segment string) bool {
+		return segment == "." || segment == ".."
+	}) {
+		return AuthorizationDecision{Reason: "request path contains dot segments"}
+	}
+	for i, rule := range p.Rules {
+		if !rule.matches(httpRequest) {
+			continue
+		}
+		result := AuthorizationDecision{Rule: &p.Rules[i]}
+		if err := rule.authorize(introspection); err != nil {
+			result.Reason = err.Error()
+		} else {
+			result.Allowed = true
+		}
+		return result
+	}
+	return AuthorizationDecision{Reason: "no rule matches the request"}
+}
+
+// Middleware returns a middleware that only passes requests that are authorized by the policy to the wrapped handler.
+// Other requests are rejected with 403 Forbidden and an insufficient_scope challenge.
+// It requires the introspection result of ResourceServer.Middleware, so it must be wrapped by it.
+func (p AuthorizationPolicy) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(response http.ResponseWriter, httpRequest *http.Request) {
+		introspection, err := IntrospectionResult(httpRequest.Context())
+		if err != nil {
+			http.Error(response, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		decision := p.Evaluate(httpRequest, introspection)
+		p.log(httpRequest, introspection, decision)
+		if !decision.Allowed {
+			challenge := oauth2.Challenge{
+				Error:            "insufficient_scope",
+				ErrorDescription: decision.Reason,
+				ResourceMetadata: p.ResourceMetadataURL,
+			}
+			if decision.Rule != nil {
+				challenge.Scope = strings.Join(decision.Rule.Scopes, " ")
+			}
+			if scheme, _ := ParseAuthorizationHeader(httpRequest); scheme != "" {
+				challenge.Scheme = scheme
+			}
+			oauth2.WriteChallenge(response, challenge)
+			return
+		}
+		next.ServeHTTP(response, httpRequest)
+	})
+}
+
+func (p AuthorizationPolicy) log(httpRequest *http.Request, introspection *iam.TokenIntrospectionResponse, decision AuthorizationDecision) {
+	logger := p.Logger
+	if logger == nil {
+		logger = slog.Default()
+	}
+	attrs := []any{
+		slog.String("method", httpRequest.Method),
+		slog.String("path", httpRequest.URL.Path),
+		slog.Bool("allowed", decision.Allowed),
+	}
+	if introspection.ClientId != nil {
+		attrs = append(attrs, slog.String("client_id", *introspection.ClientId))
+	}
+	if decision.Rule != nil {
+		attrs = append(attrs, slog.String("rule", decision.Rule.Path))
+	}
+	if decision.Reason != "" {
+		attrs = append(attrs, slog.String("reason", decision.Reason))
+	}
+	logger.InfoContext(httpRequest.Context(), "Authorization decision", attrs...)
+}
+
+func (r AuthorizationRule) matches(httpRequest *http.Request) bool {
+	if len(r.Methods) > 0 && !slices.ContainsFunc(r.Methods, func(method string) bool {
+		return strings.EqualFold(method, httpRequest.Method)
+	}) {
+		return false
+	}
+	requestPath := httpRequest.URL.Path
+	if prefix, ok := strings.CutSuffix(r.Path, "/**"); ok {
+		if matched, _ := path.Match(prefix, requestPath); matched {
+			return true
+		}
+		// Match the prefix against the same number of segments of the request path
+		segments := strings.Split(requestPath, "/")
+		prefixLength := strings.Count(prefix, "/") + 1
+		if len(segments) < prefixLength {
+			return false
+		}
+		matched, _ := path.Match(prefix, strings.Join(segments[:prefixLength], "/"))
+		return matched
+	}
+	matched, _ := path.Match(r.Path, requestPath)
+	return matched
+}
+
+func (r AuthorizationRule) authorize(introspection *iam.TokenIntrospectionResponse) error {
+	var grantedScopes []string
+	if introspection.Scope != nil {
+		grantedScopes = strings.Fields(*introspection.Scope)
+	}
+	for _, scope := range r.Scopes {
+		if !slices.Contains(grantedScopes, scope) {
+			return fmt.Errorf("scope %s is required", scope)
+		}
+	}
+	if len(r.Clients) > 0 && (introspection.ClientId == nil || !slices.Contains(r.Clients, *introspection.ClientId)) {
+		return errors.New("client is not allowed")
+	}
+	fields := make([]string, 0, len(r.Fields))
+	for field := range r.Fields {
+		fields = append(fields, field)
+	}
+	slices.Sort(fields)
+	for _, field := range fields {
+		expected := r.Fields[field]
+		value, ok := introspection.AdditionalProperties[field]
+		if !ok || value == nil {
+			return fmt.Errorf("field %s is required", field)
+		}
+		if expected != "" && fmt.Sprint(value) != expected {
+			return fmt.Errorf("field %s has an unexpected value", field)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,193 @@
+package nuts
+
+import (
+	"bytes"
+	"context"
+	"github.com/nuts-foundation/go-nuts-client/nuts/iam"
+	"github.com/stretchr/testify/require"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestLoadAuthorizationPolicy(t *testing.T) {
+	t.Run("ok", func(t *testing.T) {
+		policy, err := LoadAuthorizationPolicy(strings.NewReader(`
+resource_metadata_url: https://resource.example.com/.well-known/oauth-protected-resource
+rules:
+  - path: /fhir/Patient/**
+    methods: [GET]
+    scopes: [patient-read]
+    fields:
+      organization_ura: ""
+`))
+
+		require.NoError(t, err)
+		require.Equal(t, "https://resource.example.com/.well-known/oauth-protected-resource", policy.ResourceMetadataURL)
+		require.Equal(t, []AuthorizationRule{{
+			Path:    "/fhir/Patient/**",
+			Methods: []string{"GET"},
+			Scopes:  []string{"patient-read"},
+			Fields:  map[string]string{"organization_ura": ""},
+		}}, policy.Rules)
+	})
+	t.Run("unknown field", func(t *testing.T) {
+		_, err := LoadAuthorizationPolicy(strings.NewReader(`
+rules:
+  - path: /fhir
+    scope: [patient-read]
+`))
+
+		require.ErrorContains(t, err, "field scope not found")
+	})
+	t.Run("relative path", func(t *testing.T) {
+		_, err := LoadAuthorizationPolicy(strings.NewReader(`
+rules:
+  - path: fhir
+`))
+
+		require.EqualError(t, err, "authorization policy: rule 0: path must start with /")
+	})
+	t.Run("invalid path pattern", func(t *testing.T) {
+		_, err := LoadAuthorizationPolicy(strings.NewReader(`
+rules:
+  - path: /fhir/[
+`))
+
+		require.EqualError(t, err, "authorization policy: rule 0: syntax error in pattern")
+	})
+}
+
+func TestAuthorizationPolicy_Evaluate(t *testing.T) {
+	policy := AuthorizationPolicy{Rules: []AuthorizationRule{
+		{
+			Path:    "/fhir/Patient/**",
+			Methods: []string{"get"},
+			Scopes:  []string{"patient-read"},
+			Fields:  map[string]string{"organization_ura": ""},
+		},
+		{
+			Path:    "/fhir/*/_history",
+			Scopes:  []string{"history"},
+			Clients: []string{"did:web:example.com"},
+		},
+		{
+			Path:   "/admin",
+			Fields: map[string]string{"employee_role": "admin"},
+		},
+	}}
+	introspection := func(scope string, clientID string, fields map[string]interface{}) *iam.TokenIntrospectionResponse {
+		return &iam.TokenIntrospectionResponse{Active: true, Scope: &scope, ClientId: &clientID, AdditionalProperties: fields}
+	}
+
+	t.Run("allowed", func(t *testing.T) {
+		for _, target := range []string{"/fhir/Patient", "/fhir/Patient/1", "/fhir/Patient/1/_history"} {
+			decision := policy.Evaluate(httptest.NewRequest(http.MethodGet, target, nil), introspection("openid patient-read", "did:web:other.com", map[string]interface{}{"organization_ura": "1234"}))
+
+			require.True(t, decision.Allowed, target)
+			require.Same(t, &policy.Rules[0], decision.Rule)
+		}
+	})
+	t.Run("missing scope", func(t *testing.T) {
+		decision := policy.Evaluate(httptest.NewRequest(http.MethodGet, "/fhir/Patient/1", nil), introspection("openid", "did:web:other.com", map[string]interface{}{"organization_ura": "1234"}))
+
+		require.False(t, decision.Allowed)
+		require.Equal(t, "scope patient-read is required", decision.Reason)
+	})
+	t.Run("missing field", func(t *testing.T) {
+		decision := policy.Evaluate(httptest.NewRequest(http.MethodGet, "/fhir/Patient/1", nil), introspection("patient-read", "did:web:other.com", nil))
+
+		require.False(t, decision.Allowed)
+		require.Equal(t, "field organization_ura is required", decision.Reason)
+	})
+	t.Run("unexpected field value", func(t *testing.T) {
+		decision := policy.Evaluate(httptest.NewRequest(http.MethodPost, "/admin", nil), introspection("", "did:web:other.com", map[string]interface{}{"employee_role": "nurse"}))
+
+		require.False(t, decision.Allowed)
+		require.Equal(t, "field employee_role has an unexpected value", decision.Reason)
+	})
+	t.Run("client not allowed", func(t *testing.T) {
+		decision := policy.Evaluate(httptest.NewRequest(http.MethodGet, "/fhir/Observation/_history", nil), introspection("history", "did:web:other.com", nil))
+
+		require.False(t, decision.Allowed)
+		require.Equal(t, "client is not allowed", decision.Reason)
+	})
+	t.Run("client allowed", func(t *testing.T) {
+		decision := policy.Evaluate(httptest.NewRequest(http.MethodGet, "/fhir/Observation/_history", nil), introspection("history", "did:web:example.com", nil))
+
+		require.True(t, decision.Allowed)
+	})
+	t.Run("no matching rule", func(t *testing.T) {
+		for _, httpRequest := range []*http.Request{
+			httptest.NewRequest(http.MethodPost, "/fhir/Patient/1", nil),
+			httptest.NewRequest(http.MethodGet, "/fhir/PatientX", nil),
+			httptest.NewRequest(http.MethodGet, "/other", nil),
+		} {
+			decision := policy.Evaluate(httpRequest, introspection("patient-read", "did:web:example.com", nil))
+
+			require.False(t, decision.Allowed)
+			require.Nil(t, decision.Rule)
+			require.Equal(t, "no rule matches the request", decision.Reason)
+		}
+	})
+	t.Run("dot segments", func(t *testing.T) {
+		for _, target := range []string{"/fhir/Patient/../../admin", "/fhir/Patient/./1", "/fhir/Patient/%2e%2e/%2E%2E/admin"} {
+			httpRequest := httptest.NewRequest(http.MethodGet, "/", nil)
+			httpRequest.URL.Path, _ = url.PathUnescape(target)
+
+			decision := policy.Evaluate(httpRequest, introspection("patient-read", "did:web:example.com", map[string]interface{}{"organization_ura": "1234", "employee_role": "admin"}))
+
+			require.False(t, decision.Allowed, target)
+			require.Equal(t, "request path contains dot segments", decision.Reason)
+		}
+	})
+}
+
+func TestAuthorizationPolicy_Middleware(t *testing.T) {
+	logs := new(bytes.Buffer)
+	policy := AuthorizationPolicy{
+		Rules:               []AuthorizationRule{{Path: "/fhir/**", Scopes: []string{"patient-read"}}},
+		ResourceMetadataURL: "https://resource.example.com/.well-known/oauth-protected-resource",
+		Logger:              slog.New(slog.NewTextHandler(logs, nil)),
+	}
+	handler := policy.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	serve := func(scope string) *httptest.ResponseRecorder {
+		httpRequest := httptest.NewRequest(http.MethodGet, "/fhir/Patient", nil)
+		httpRequest.Header.Set("Authorization", "DPoP token")
+		result := &iam.TokenIntrospectionResponse{Active: true, Scope: &scope}
+		httpRequest = httpRequest.WithContext(context.WithValue(httpRequest.Context(), introspectionResultKey, result))
+		response := httptest.NewRecorder()
+		handler.ServeHTTP(response, httpRequest)
+		return response
+	}
+
+	t.Run("allowed", func(t *testing.T) {
+		logs.Reset()
+
+		response := serve("patient-read")
+
+		require.Equal(t, http.StatusNoContent, response.Code)
+		require.Contains(t, logs.String(), `msg="Authorization decision" method=GET path=/fhir/Patient allowed=true rule=/fhir/**`)
+	})
+	t.Run("denied", func(t *testing.T) {
+		logs.Reset()
+
+		response := serve("other")
+
+		require.Equal(t, http.StatusForbidden, response.Code)
+		require.Equal(t, `DPoP error="insufficient_scope", error_description="scope patient-read is required", scope="patient-read", resource_metadata="https://resource.example.com/.well-known/oauth-protected-resource"`, response.Header().Get("WWW-Authenticate"))
+		require.Contains(t, logs.String(), `allowed=false rule=/fhir/** reason="scope patient-read is required"`)
+	})
+	t.Run("not wrapped by ResourceServer", func(t *testing.T) {
+		response := httptest.NewRecorder()
+
+		policy.Middleware(nil).ServeHTTP(response, httptest.NewRequest(http.MethodGet, "/", nil))
+
+		require.Equal(t, http.StatusInternalServerError, response.Code)
+	})
+}
@@ -0,0 +1,270 @@
+package nuts
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	ssi "github.com/nuts-foundation/go-did"
+	"github.com/nuts-foundation/go-did/vc"
+	"github.com/nuts-foundation/go-nuts-client/nuts/iam"
+	"github.com/nuts-foundation/go-nuts-client/nuts/pe"
+	"strings"
+)
+
+// Principal describes the party an access token was issued to,
+// derived from the Verifiable Presentations that were presented to obtain it.
+type Principal struct {
+	// ClientID is the DID of the client the access token was issued to.
+	ClientID string
+	// Scope contains the granted scopes.
+	Scope []string
+	// Organization is the requesting organization, derived from its NutsOrganizationCredential and/or NutsUraCredential.
+	// It is nil if no such credential was presented.
+	Organization *Organization
+	// Employee is the user that requested the access token, derived from the EmployeeCredential.
+	// It is nil if no EmployeeCredential was presented.
+	Employee *EmployeeDetails
+	// Fields contains the values of the fields (with an id) of the presentation definitions' input descriptors,
+	// extracted from the credentials submitted for them. It is keyed by input descriptor ID, then field ID.
+	Fields map[string]map[string]interface{}
+}
+
+// Organization is a care organization, as described by its NutsOrganizationCredential and/or NutsUraCredential.
+type Organization struct {
+	Name string `json:"name"`
+	City string `json:"city"`
+	// URA is the UZI Register Abonneenummer of the organization, if it presented a NutsUraCredential.
+	URA string `json:"ura"`
+}
+
+// Merge sets the fields that are set in other, so the fields of multiple credentials complement each other,
+// e.g. the URA comes from the NutsUraCredential.
+func (o *Organization) Merge(other Organization) {
+	if other.Name != "" {
+		o.Name = other.Name
+	}
+	if other.City != "" {
+		o.City = other.City
+	}
+	if other.URA != "" {
+		o.URA = other.URA
+	}
+}
+
+// Principal introspects the access token at the Nuts node and returns the Principal it was issued to.
+// It uses extended introspection, which returns the presentations that were presented to obtain the access token.
+func (r ResourceServer) Principal(ctx context.Context, token string) (*Principal, error) {
+	client, err := newIAMClient(r.NutsAPIURL, r.NutsHttpClient)
+	if err != nil {
+		return nil, err
+	}
+	httpResponse, err := client.IntrospectAccessTokenExtendedWithFormdataBody(ctx, iam.IntrospectAccessTokenExtendedFormdataRequestBody{Token: token})
+	response, err := ParseResponse(err, httpResponse, iam.ParseIntrospectAccessTokenExtendedResponse)
+	if err != nil {
+		return nil, fmt.Errorf("extended access token introspection: %w", err)
+	}
+	if response.JSON200 == nil {
+		return nil, fmt.Errorf("failed extended access token introspection response: %s", response.Status())
+	}
+	return NewPrincipal(*response.JSON200)
+}
+
+// NewPrincipal returns the Principal described by the result of extended access token introspection.
+func NewPrincipal(introspection iam.ExtendedTokenIntrospectionResponse) (*Principal, error) {
+	if !introspection.Active {
+		return nil, errors.New("access token is not active")
+	}
+	result := Principal{
+		Fields: make(map[string]map[string]interface{}),
+	}
+	if introspection.ClientId != nil {
+		result.ClientID = *introspection.ClientId
+	}
+	if introspection.Scope != nil {
+		result.Scope = strings.Fields(*introspection.Scope)
+	}
+	var presentations []vc.VerifiablePresentation
+	if introspection.Vps != nil {
+		presentations = *introspection.Vps
+	}
+	for _, presentation := range presentations {
+		for _, credential := range presentation.VerifiableCredential {
+			if err := result.addCredential(credential); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if introspection.PresentationSubmissions == nil || introspection.PresentationDefinitions == nil {
+		return &result, nil
+	}
+	definitions := make(map[string]*pe.PresentationDefinition)
+	for _, curr := range *introspection.PresentationDefinitions {
+		definition, err := pe.ParsePresentationDefinition(curr)
+		if err != nil {
+			return nil, err
+		}
+		definitions[definition.ID] = definition
+	}
+	documents, err := presentationDocuments(presentations)
+	if err != nil {
+		return nil, err
+	}
+	for _, curr := range *introspection.PresentationSubmissions {
+		submission, err := pe.ParsePresentationSubmission(curr)
+		if err != nil {
+			return nil, err
+		}
+		definition, ok := definitions[submission.DefinitionID]
+		if !ok {
+			continue
+		}
+		for _, mapping := range submission.DescriptorMap {
+			descriptor, ok := inputDescriptor(*definition, mapping.ID)
+			if !ok {
+				continue
+			}
+			credential, err := submittedCredential(documents, mapping)
+			if err != nil {
+				return nil, fmt.Errorf("input descriptor %s: %w", mapping.ID, err)
+			}
+			fields, err := descriptor.ExtractFields(*credential)
+			if err != nil {
+				return nil, fmt.Errorf("input descriptor %s: %w", mapping.ID, err)
+			}
+			result.Fields[mapping.ID] = fields
+		}
+	}
+	return &result, nil
+}
+
+func (p *Principal) addCredential(credential vc.VerifiableCredential) error {
+	switch {
+	case credential.IsType(ssi.MustParseURI("NutsOrganizationCredential")), credential.IsType(ssi.MustParseURI("NutsUraCredential")):
+		var subjects []struct {
+			Organization Organization `json:"organization"`
+		}
+		if err := credential.UnmarshalCredentialSubject(&subjects); err != nil {
+			return fmt.Errorf("invalid organization credential: %w", err)
+		}
+		if len(subjects) == 0 {
+			return nil
+		}
+		if p.Organization == nil {
+			p.Organization = &Organization{}
+		}
+		p.Organization.Merge(subjects[0].Organization)
+	case credential.IsType(ssi.MustParseURI("EmployeeCredential")):
+		var subjects []struct {
+			Identifier string `json:"identifier"`
+			Name       string `json:"name"`
+			RoleName   string `json:"roleName"`
+		}
+		if err := credential.UnmarshalCredentialSubject(&subjects); err != nil {
+			return fmt.Errorf("invalid EmployeeCredential: %w", err)
+		}
+		if len(subjects) == 0 {
+			return nil
+		}
+		p.Employee = &EmployeeDetails{
+			Id:             subjects[0].Identifier,
+			Name:           subjects[0].Name,
+			Role:           subjects[0].RoleName,
+			ExpirationDate: credential.ExpirationDate,
+		}
+	}
+	return nil
+}
+
+func inputDescriptor(definition pe.PresentationDefinition, id string) (pe.InputDescriptor, bool) {
+	for _, descriptor := range definition.InputDescriptors {
+		if descriptor.ID == id {
+			return descriptor, true
+		}
+	}
+	return pe.InputDescriptor{}, false
+}
+
+// presentationDocuments returns the presentations as generic JSON documents, to resolve the paths of presentation submissions against.
+// JSON-LD presentations are kept in their original form, since a single credential can be either an object or an array of one.
+// JWT presentations are represented by their claims, so the credentials are at $.vp.verifiableCredential.
+func presentationDocuments(presentations []vc.VerifiablePresentation) ([]interface{}, error) {
+	var result []interface{}
+	for _, presentation := range presentations {
+		var data []byte
+		if presentation.Format() == vc.JWTPresentationProofFormat {
+			parts := strings.Split(presentation.Raw(), ".")
+			if len(parts) != 3 {
+				return nil, errors.New("invalid JWT presentation")
+			}
+			var err error
+			if data, err = base64.RawURLEncoding.DecodeString(parts[1]); err != nil {
+				return nil, fmt.Errorf("invalid JWT presentation: %w", err)
+			}
+		} else {
+			var err error
+			if data, err = json.Marshal(presentation); err != nil {
+				return nil, err
+			}
+		}
+		var document interface{}
+		if err := json.Unmarshal(data, &document); err != nil {
+			return nil, fmt.Errorf("invalid presentation: %w", err)
+		}
+		result = append(result, document)
+	}
+	return result, nil
+}
+
+// submittedCredential returns the credential a descriptor mapping of a presentation submission points to.
+// If multiple presentations were submitted, the path points to the presentation and the nested path to the credential.
+// Otherwise, the path is relative to the (first) presentation.
+func submittedCredential(presentations []interface{}, mapping pe.InputDescriptorMappingObject) (*vc.VerifiableCredential, error) {
+	if len(presentations) == 0 {
+		return nil, errors.New("submitted credential not found")
+	}
+	presentation := presentations[0]
+	credentialPath := mapping.Path
+	if mapping.PathNested != nil {
+		var err error
+		if presentation, err = resolveSubmissionPath(presentations, mapping.Path); err != nil {
+			return nil, err
+		}
+		credentialPath = mapping.PathNested.Path
+	}
+	value, err := resolveSubmissionPath(presentation, credentialPath)
+	if err != nil {
+		return nil, err
+	}
+	// JWT credentials are strings, JSON-LD credentials objects
+	raw, ok := value.(string)
+	if !ok {
+		data, err := json.Marshal(value)
+		if err != nil {
+			return nil, err
+		}
+		raw = string(data)
+	}
+	credential, err := vc.ParseVerifiableCredential(raw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid submitted credential: %w", err)
+	}
+	return credential, nil
+}
+
+// resolveSubmissionPath resolves a path of a presentation submission, which must select exactly one value.
+func resolveSubmissionPath(document interface{}, path string) (interface{}, error) {
+	values, err := pe.ResolveJSONPath(document, path)
+	if err != nil {
+		return nil, err
+	}
+	switch len(values) {
+	case 0:
+		return nil, errors.New("submitted credential not found")
+	case 1:
+		return values[0], nil
+	default:
+		return nil, fmt.Errorf("path %s selects multiple values", path)
+	}
+}
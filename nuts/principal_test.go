@@ -0,0 +1,225 @@
+package nuts
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"github.com/nuts-foundation/go-nuts-client/nuts/iam"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+const principalIntrospectionResponse = `{
+  "active": true,
+  "client_id": "did:web:example.com:iam:requester",
+  "scope": "eOverdracht-sender openid",
+  "presentation_definitions": {
+    "organization": {
+      "id": "pd_eoverdracht",
+      "input_descriptors": [
+        {
+          "id": "id_ura_credential",
+          "constraints": {
+            "fields": [
+              {"path": ["$.type"], "filter": {"type": "string", "const": "NutsUraCredential"}},
+              {"id": "organization_ura", "path": ["$.credentialSubject.organization.ura"]},
+              {"id": "organization_name", "path": ["$.credentialSubject.organization.tradeName", "$.credentialSubject['organization']['name']"]},
+              {"id": "organization_unknown", "path": ["$.credentialSubject.organization.unknown"]}
+            ]
+          }
+        },
+        {
+          "id": "id_employee_credential",
+          "constraints": {
+            "fields": [
+              {"id": "employee_role", "path": ["$.credentialSubject.roleName"]},
+              {"id": "employee_type", "path": ["$.type[1]"]}
+            ]
+          }
+        }
+      ]
+    }
+  },
+  "presentation_submissions": {
+    "pd_eoverdracht": {
+      "id": "submission",
+      "definition_id": "pd_eoverdracht",
+      "descriptor_map": [
+        {"id": "id_ura_credential", "format": "ldp_vp", "path": "$[0]", "path_nested": {"format": "ldp_vc", "path": "$.verifiableCredential[1]"}},
+        {"id": "id_employee_credential", "format": "ldp_vp", "path": "$[1]", "path_nested": {"format": "ldp_vc", "path": "$.verifiableCredential[0]"}}
+      ]
+    }
+  },
+  "vps": [
+    {
+      "@context": ["https://www.w3.org/2018/credentials/v1"],
+      "type": "VerifiablePresentation",
+      "verifiableCredential": [
+        {
+          "@context": ["https://www.w3.org/2018/credentials/v1", "https://nuts.nl/credentials/v1"],
+          "type": ["VerifiableCredential", "NutsOrganizationCredential"],
+          "issuer": "did:web:example.com:iam:issuer",
+          "issuanceDate": "2024-01-01T00:00:00Z",
+          "credentialSubject": {"id": "did:web:example.com:iam:requester", "organization": {"name": "Hospital", "city": "Amsterdam"}}
+        },
+        {
+          "@context": ["https://www.w3.org/2018/credentials/v1", "https://nuts.nl/credentials/v1"],
+          "type": ["VerifiableCredential", "NutsUraCredential"],
+          "issuer": "did:web:example.com:iam:issuer",
+          "issuanceDate": "2024-01-01T00:00:00Z",
+          "credentialSubject": {"id": "did:web:example.com:iam:requester", "organization": {"ura": "1234", "name": "Hospital B.V."}}
+        }
+      ]
+    },
+    {
+      "@context": ["https://www.w3.org/2018/credentials/v1"],
+      "type": "VerifiablePresentation",
+      "verifiableCredential": [
+        {
+          "@context": ["https://www.w3.org/2018/credentials/v1", "https://nuts.nl/credentials/v1"],
+          "type": ["VerifiableCredential", "EmployeeCredential"],
+          "issuer": "did:jwk:user",
+          "issuanceDate": "2024-01-01T00:00:00Z",
+          "credentialSubject": {"id": "did:jwk:user", "identifier": "jdoe@example.com", "name": "John Doe", "roleName": "Nurse"}
+        }
+      ]
+    }
+  ]
+}`
+
+func TestResourceServer_Principal(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /internal/auth/v2/accesstoken/introspect_extended", func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, r.ParseForm())
+		w.Header().Set("Content-Type", "application/json")
+		if r.PostForm.Get("token") != "token" {
+			w.WriteHeader(http.StatusOK)
+			_, _ = w.Write([]byte(`{"active":false}`))
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte(principalIntrospectionResponse))
+	})
+	httpServer := httptest.NewServer(mux)
+	resourceServer := ResourceServer{NutsAPIURL: httpServer.URL}
+
+	t.Run("ok", func(t *testing.T) {
+		principal, err := resourceServer.Principal(context.Background(), "token")
+
+		require.NoError(t, err)
+		require.Equal(t, "did:web:example.com:iam:requester", principal.ClientID)
+		require.Equal(t, []string{"eOverdracht-sender", "openid"}, principal.Scope)
+		require.Equal(t, &Organization{Name: "Hospital B.V.", City: "Amsterdam", URA: "1234"}, principal.Organization)
+		require.Equal(t, &EmployeeDetails{Id: "jdoe@example.com", Name: "John Doe", Role: "Nurse"}, principal.Employee)
+		require.Equal(t, map[string]map[string]interface{}{
+			"id_ura_credential": {
+				"organization_ura":  "1234",
+				"organization_name": "Hospital B.V.",
+			},
+			"id_employee_credential": {
+				"employee_role": "Nurse",
+				"employee_type": "EmployeeCredential",
+			},
+		}, principal.Fields)
+	})
+	t.Run("inactive token", func(t *testing.T) {
+		_, err := resourceServer.Principal(context.Background(), "other")
+
+		require.EqualError(t, err, "access token is not active")
+	})
+}
+
+func TestNewPrincipal(t *testing.T) {
+	t.Run("without presentations", func(t *testing.T) {
+		principal, err := NewPrincipal(iam.ExtendedTokenIntrospectionResponse{Active: true})
+
+		require.NoError(t, err)
+		require.Nil(t, principal.Organization)
+		require.Nil(t, principal.Employee)
+		require.Empty(t, principal.Fields)
+	})
+	t.Run("submission points to unknown credential", func(t *testing.T) {
+		var introspection iam.ExtendedTokenIntrospectionResponse
+		require.NoError(t, json.Unmarshal([]byte(principalIntrospectionResponse), &introspection))
+		mapping := (*introspection.PresentationSubmissions)["pd_eoverdracht"]["descriptor_map"].([]interface{})[1].(map[string]interface{})
+		mapping["path"] = "$[5]"
+
+		_, err := NewPrincipal(introspection)
+
+		require.EqualError(t, err, "input descriptor id_employee_credential: submitted credential not found")
+	})
+	const definitions = `{
+  "organization": {
+    "id": "pd_organization",
+    "input_descriptors": [{"id": "id_ura_credential", "constraints": {"fields": [{"id": "organization_ura", "path": ["$.credentialSubject.organization.ura"]}]}}]
+  }
+}`
+	const uraCredential = `{
+  "@context": ["https://www.w3.org/2018/credentials/v1", "https://nuts.nl/credentials/v1"],
+  "type": ["VerifiableCredential", "NutsUraCredential"],
+  "issuer": "did:web:example.com:iam:issuer",
+  "issuanceDate": "2024-01-01T00:00:00Z",
+  "credentialSubject": {"id": "did:web:example.com:iam:requester", "organization": {"ura": "1234"}}
+}`
+	newIntrospection := func(t *testing.T, submissions string, presentation string) iam.ExtendedTokenIntrospectionResponse {
+		var introspection iam.ExtendedTokenIntrospectionResponse
+		data := `{"active": true, "presentation_definitions": ` + definitions + `, "presentation_submissions": ` + submissions + `, "vps": [` + presentation + `]}`
+		require.NoError(t, json.Unmarshal([]byte(data), &introspection))
+		return introspection
+	}
+	t.Run("single credential in presentation", func(t *testing.T) {
+		introspection := newIntrospection(t,
+			`{"pd_organization": {"id": "submission", "definition_id": "pd_organization", "descriptor_map": [{"id": "id_ura_credential", "format": "ldp_vc", "path": "$.verifiableCredential"}]}}`,
+			`{"@context": ["https://www.w3.org/2018/credentials/v1"], "type": "VerifiablePresentation", "verifiableCredential": `+uraCredential+`}`)
+
+		principal, err := NewPrincipal(introspection)
+
+		require.NoError(t, err)
+		require.Equal(t, map[string]map[string]interface{}{"id_ura_credential": {"organization_ura": "1234"}}, principal.Fields)
+	})
+	t.Run("JWT presentation", func(t *testing.T) {
+		var credential map[string]interface{}
+		require.NoError(t, json.Unmarshal([]byte(uraCredential), &credential))
+		jwtCredential := unsignedJWT(t, map[string]interface{}{
+			"iss": credential["issuer"],
+			"sub": "did:web:example.com:iam:requester",
+			"vc":  credential,
+		})
+		jwtPresentation := unsignedJWT(t, map[string]interface{}{
+			"iss": "did:web:example.com:iam:requester",
+			"vp": map[string]interface{}{
+				"@context":             []string{"https://www.w3.org/2018/credentials/v1"},
+				"type":                 "VerifiablePresentation",
+				"verifiableCredential": []string{jwtCredential},
+			},
+		})
+		introspection := newIntrospection(t,
+			`{"pd_organization": {"id": "submission", "definition_id": "pd_organization", "descriptor_map": [{"id": "id_ura_credential", "format": "jwt_vc", "path": "$.vp.verifiableCredential[0]"}]}}`,
+			`"`+jwtPresentation+`"`)
+
+		principal, err := NewPrincipal(introspection)
+
+		require.NoError(t, err)
+		require.Equal(t, &Organization{URA: "1234"}, principal.Organization)
+		require.Equal(t, map[string]map[string]interface{}{"id_ura_credential": {"organization_ura": "1234"}}, principal.Fields)
+	})
+	t.Run("input descriptor of other presentation definition", func(t *testing.T) {
+		introspection := newIntrospection(t,
+			`{"pd_other": {"id": "submission", "definition_id": "pd_other", "descriptor_map": [{"id": "id_ura_credential", "format": "ldp_vc", "path": "$.verifiableCredential"}]}}`,
+			`{"@context": ["https://www.w3.org/2018/credentials/v1"], "type": "VerifiablePresentation", "verifiableCredential": `+uraCredential+`}`)
+
+		principal, err := NewPrincipal(introspection)
+
+		require.NoError(t, err)
+		require.Empty(t, principal.Fields)
+	})
+}
+
+// unsignedJWT returns a JWT with the given claims. It isn't signed, since it's only parsed.
+func unsignedJWT(t *testing.T, claims map[string]interface{}) string {
+	payload, err := json.Marshal(claims)
+	require.NoError(t, err)
+	return base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"ES256"}`)) + "." + base64.RawURLEncoding.EncodeToString(payload) + ".c2lnbmF0dXJl"
+}
@@ -0,0 +1,128 @@
+package nuts
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/nuts-foundation/go-nuts-client/nuts/iam"
+	"github.com/nuts-foundation/go-nuts-client/oauth2"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// ResourceServer protects HTTP handlers of an OAuth2 Resource Server with Nuts access tokens,
+// which are introspected at the local Nuts node.
+type ResourceServer struct {
+	// NutsAPIURL is the base URL of the Nuts node API.
+	NutsAPIURL string
+	// NutsHttpClient is the HTTP client used to communicate with the Nuts node.
+	// If not set, http.DefaultClient is used.
+	NutsHttpClient *http.Client
+	// ResourceMetadataURL is the URL of the protected resource metadata, which is advertised in the WWW-Authenticate challenge.
+	ResourceMetadataURL string
+	// Cache optionally caches introspection results, to avoid a round trip to the Nuts node for every request.
+	Cache *IntrospectionCache
+	// DPoP validates the DPoP proofs of requests with DPoP-bound access tokens.
+	// If not set, DPoP-bound access tokens (and the DPoP scheme) are rejected.
+	DPoP *DPoPValidator
+}
+
+// Middleware returns a middleware that only passes requests with an active access token to the wrapped handler.
+// DPoP-bound access tokens are only accepted with a valid DPoP proof, which requires DPoP to be set.
+// Other requests are rejected with 401 Unauthorized and a WWW-Authenticate challenge.
+// The introspection result is available to the wrapped handler through IntrospectionResult.
+func (r ResourceServer) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(response http.ResponseWriter, httpRequest *http.Request) {
+		scheme, token := ParseAuthorizationHeader(httpRequest)
+		if token == "" {
+			r.challenge(response, "Bearer", "", "")
+			return
+		}
+		var result *iam.TokenIntrospectionResponse
+		var err error
+		if r.Cache != nil {
+			result, err = r.Cache.Get(httpRequest.Context(), token, r.introspect)
+		} else {
+			result, err = r.introspect(httpRequest.Context(), token)
+		}
+		if err != nil {
+			http.Error(response, "access token introspection failed", http.StatusBadGateway)
+			return
+		}
+		if !result.Active {
+			r.challenge(response, scheme, "invalid_token", "access token is not active")
+			return
+		}
+		if result.Exp != nil && time.Unix(int64(*result.Exp), 0).Before(time.Now()) {
+			r.challenge(response, scheme, "invalid_token", "access token has expired")
+			return
+		}
+		httpRequest = httpRequest.WithContext(context.WithValue(httpRequest.Context(), introspectionResultKey, result))
+		if r.DPoP != nil {
+			r.DPoP.Middleware(next).ServeHTTP(response, httpRequest)
+			return
+		}
+		if result.Cnf != nil || scheme == "DPoP" {
+			r.challenge(response, scheme, "invalid_token", "DPoP-bound access tokens are not supported")
+			return
+		}
+		next.ServeHTTP(response, httpRequest)
+	})
+}
+
+func (r ResourceServer) introspect(ctx context.Context, token string) (*iam.TokenIntrospectionResponse, error) {
+	client, err := newIAMClient(r.NutsAPIURL, r.NutsHttpClient)
+	if err != nil {
+		return nil, err
+	}
+	httpResponse, err := client.IntrospectAccessTokenWithFormdataBody(ctx, iam.IntrospectAccessTokenFormdataRequestBody{Token: token})
+	response, err := ParseResponse(err, httpResponse, iam.ParseIntrospectAccessTokenResponse)
+	if err != nil {
+		return nil, fmt.Errorf("access token introspection: %w", err)
+	}
+	if response.JSON200 == nil {
+		return nil, fmt.Errorf("failed access token introspection response: %s", response.Status())
+	}
+	return response.JSON200, nil
+}
+
+func (r ResourceServer) challenge(response http.ResponseWriter, scheme string, errorCode string, errorDescription string) {
+	oauth2.WriteChallenge(response, oauth2.Challenge{
+		Scheme:           scheme,
+		Error:            errorCode,
+		ErrorDescription: errorDescription,
+		ResourceMetadata: r.ResourceMetadataURL,
+	})
+}
+
+// ParseAuthorizationHeader returns the scheme (Bearer or DPoP) and access token from the Authorization header of the request.
+// If the header is missing or uses another scheme, empty strings are returned.
+func ParseAuthorizationHeader(httpRequest *http.Request) (scheme string, token string) {
+	scheme, token, ok := strings.Cut(httpRequest.Header.Get("Authorization"), " ")
+	if !ok {
+		return "", ""
+	}
+	token = strings.TrimSpace(token)
+	switch {
+	case strings.EqualFold(scheme, "Bearer"):
+		return "Bearer", token
+	case strings.EqualFold(scheme, "DPoP"):
+		return "DPoP", token
+	default:
+		return "", ""
+	}
+}
+
+type introspectionResultKeyType struct{}
+
+var introspectionResultKey = introspectionResultKeyType{}
+
+// IntrospectionResult returns the introspected access token set by ResourceServer.Middleware.
+func IntrospectionResult(ctx context.Context) (*iam.TokenIntrospectionResponse, error) {
+	result, ok := ctx.Value(introspectionResultKey).(*iam.TokenIntrospectionResponse)
+	if !ok {
+		return nil, errors.New("no access token introspection result in context")
+	}
+	return result, nil
+}
@@ -0,0 +1,137 @@
+package nuts
+
+import (
+	"fmt"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestResourceServer_Middleware(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /internal/auth/v2/accesstoken/introspect", func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, r.ParseForm())
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		switch r.PostForm.Get("token") {
+		case "active":
+			_, _ = fmt.Fprintf(w, `{"active":true,"client_id":"did:web:client.example.com","scope":"test","exp":%d}`, time.Now().Add(time.Hour).Unix())
+		case "dpop-bound":
+			_, _ = fmt.Fprintf(w, `{"active":true,"client_id":"did:web:client.example.com","cnf":{"jkt":"thumbprint"},"exp":%d}`, time.Now().Add(time.Hour).Unix())
+		case "expired":
+			_, _ = fmt.Fprintf(w, `{"active":true,"exp":%d}`, time.Now().Add(-time.Hour).Unix())
+		default:
+			_, _ = w.Write([]byte(`{"active":false}`))
+		}
+	})
+	httpServer := httptest.NewServer(mux)
+	resourceServer := ResourceServer{
+		NutsAPIURL:          httpServer.URL,
+		ResourceMetadataURL: "https://resource.example.com/.well-known/oauth-protected-resource",
+	}
+	handler := resourceServer.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		result, err := IntrospectionResult(r.Context())
+		require.NoError(t, err)
+		_, _ = w.Write([]byte(*result.ClientId))
+	}))
+	serve := func(authorization string) *httptest.ResponseRecorder {
+		httpRequest := httptest.NewRequest(http.MethodGet, "/resource", nil)
+		if authorization != "" {
+			httpRequest.Header.Set("Authorization", authorization)
+		}
+		response := httptest.NewRecorder()
+		handler.ServeHTTP(response, httpRequest)
+		return response
+	}
+
+	t.Run("active token", func(t *testing.T) {
+		response := serve("Bearer active")
+
+		require.Equal(t, http.StatusOK, response.Code)
+		require.Equal(t, "did:web:client.example.com", response.Body.String())
+	})
+	t.Run("DPoP-bound token without DPoP validator", func(t *testing.T) {
+		response := serve("Bearer dpop-bound")
+
+		require.Equal(t, http.StatusUnauthorized, response.Code)
+		require.Contains(t, response.Header().Get("WWW-Authenticate"), `error_description="DPoP-bound access tokens are not supported"`)
+	})
+	t.Run("DPoP scheme without DPoP validator", func(t *testing.T) {
+		response := serve("DPoP dpop-bound")
+
+		require.Equal(t, http.StatusUnauthorized, response.Code)
+		require.Contains(t, response.Header().Get("WWW-Authenticate"), `DPoP error="invalid_token"`)
+	})
+	t.Run("no token", func(t *testing.T) {
+		response := serve("")
+
+		require.Equal(t, http.StatusUnauthorized, response.Code)
+		require.Equal(t, `Bearer resource_metadata="https://resource.example.com/.well-known/oauth-protected-resource"`, response.Header().Get("WWW-Authenticate"))
+	})
+	t.Run("unsupported scheme", func(t *testing.T) {
+		response := serve("Basic foo")
+
+		require.Equal(t, http.StatusUnauthorized, response.Code)
+	})
+	t.Run("inactive token", func(t *testing.T) {
+		response := serve("DPoP inactive")
+
+		require.Equal(t, http.StatusUnauthorized, response.Code)
+		require.Equal(t, `DPoP error="invalid_token", error_description="access token is not active", resource_metadata="https://resource.example.com/.well-known/oauth-protected-resource"`, response.Header().Get("WWW-Authenticate"))
+	})
+	t.Run("expired token", func(t *testing.T) {
+		response := serve("Bearer expired")
+
+		require.Equal(t, http.StatusUnauthorized, response.Code)
+		require.Contains(t, response.Header().Get("WWW-Authenticate"), `error_description="access token has expired"`)
+	})
+	t.Run("introspection fails", func(t *testing.T) {
+		handler := ResourceServer{NutsAPIURL: "http://localhost:0"}.Middleware(nil)
+		httpRequest := httptest.NewRequest(http.MethodGet, "/resource", nil)
+		httpRequest.Header.Set("Authorization", "Bearer active")
+		response := httptest.NewRecorder()
+
+		handler.ServeHTTP(response, httpRequest)
+
+		require.Equal(t, http.StatusBadGateway, response.Code)
+	})
+}
+
+func TestResourceServer_Middleware_Cache(t *testing.T) {
+	var calls atomic.Int32
+	httpServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		_, _ = fmt.Fprintf(w, `{"active":true,"exp":%d}`, time.Now().Add(time.Hour).Unix())
+	}))
+	handler := ResourceServer{
+		NutsAPIURL: httpServer.URL,
+		Cache:      &IntrospectionCache{},
+	}.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	for i := 0; i < 3; i++ {
+		httpRequest := httptest.NewRequest(http.MethodGet, "/resource", nil)
+		httpRequest.Header.Set("Authorization", "Bearer token")
+		response := httptest.NewRecorder()
+		handler.ServeHTTP(response, httpRequest)
+		require.Equal(t, http.StatusNoContent, response.Code)
+	}
+
+	require.Equal(t, int32(1), calls.Load())
+}
+
+func TestParseAuthorizationHeader(t *testing.T) {
+	httpRequest := httptest.NewRequest(http.MethodGet, "/", nil)
+	httpRequest.Header.Set("Authorization", "bearer token")
+
+	scheme, token := ParseAuthorizationHeader(httpRequest)
+
+	require.Equal(t, "Bearer", scheme)
+	require.Equal(t, "token", token)
+}
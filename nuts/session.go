@@ -0,0 +1,237 @@
+package nuts
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/nuts-foundation/go-nuts-client/oauth2"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// DefaultSessionCookieName is the name of the cookie used by the session stores if no name is configured.
+const DefaultSessionCookieName = "nuts-session"
+
+// DefaultSessionTTL is the duration a session store keeps a session after it was last saved, if no TTL is configured.
+const DefaultSessionTTL = time.Hour
+
+// DefaultMaxSessions is the maximum number of sessions an InMemorySessionStore keeps, if no maximum is configured.
+const DefaultMaxSessions = 10000
+
+// UserSession contains the state of the user access token flow for a user-agent (browser).
+type UserSession struct {
+	// FlowSessionID is the Nuts node's session ID of a pending user access token flow.
+	FlowSessionID string
+	// ReturnURL is the (relative) URL the user-agent is redirected to when the flow finished.
+	ReturnURL string
+	// Token is the user access token, once obtained.
+	Token *oauth2.Token
+}
+
+// SessionStore stores the UserSession of a user-agent.
+type SessionStore interface {
+	// Get returns the session of the user-agent, or nil if there is none.
+	Get(httpRequest *http.Request) (*UserSession, error)
+	// Save stores the session of the user-agent.
+	Save(response http.ResponseWriter, httpRequest *http.Request, session UserSession) error
+}
+
+var _ SessionStore = &InMemorySessionStore{}
+
+// InMemorySessionStore keeps sessions in memory, referenced by a random session ID in a cookie.
+// Sessions are lost when the application restarts, and are not shared between application instances.
+// Session IDs are only issued by the store: a session ID in a cookie is only reused if the store knows it,
+// and a new session ID is issued when an access token is stored, to prevent session fixation.
+type InMemorySessionStore struct {
+	// CookieName is the name of the session cookie. If not set, DefaultSessionCookieName is used.
+	CookieName string
+	// TTL is the duration a session is kept after it was last saved. If not set, DefaultSessionTTL is used.
+	TTL time.Duration
+	// MaxSessions is the maximum number of sessions kept; when reached, the session that expires first is evicted.
+	// If not set, DefaultMaxSessions is used.
+	MaxSessions int
+	mux         sync.Mutex
+	sessions    map[string]inMemorySession
+}
+
+type inMemorySession struct {
+	session   UserSession
+	expiresAt time.Time
+}
+
+func (s *InMemorySessionStore) Get(httpRequest *http.Request) (*UserSession, error) {
+	cookie, err := httpRequest.Cookie(cookieName(s.CookieName))
+	if err != nil {
+		return nil, nil
+	}
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	entry, ok := s.sessions[cookie.Value]
+	if !ok || !time.Now().Before(entry.expiresAt) {
+		return nil, nil
+	}
+	return &entry.session, nil
+}
+
+func (s *InMemorySessionStore) Save(response http.ResponseWriter, httpRequest *http.Request, session UserSession) error {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	now := time.Now()
+	var sessionID string
+	if cookie, err := httpRequest.Cookie(cookieName(s.CookieName)); err == nil {
+		if entry, ok := s.sessions[cookie.Value]; ok && now.Before(entry.expiresAt) && session.Token == nil {
+			sessionID = cookie.Value
+		} else {
+			delete(s.sessions, cookie.Value)
+		}
+	}
+	if sessionID == "" {
+		data := make([]byte, 32)
+		if _, err := rand.Read(data); err != nil {
+			return err
+		}
+		sessionID = base64.RawURLEncoding.EncodeToString(data)
+		http.SetCookie(response, sessionCookie(s.CookieName, sessionID))
+	}
+	if s.sessions == nil {
+		s.sessions = make(map[string]inMemorySession)
+	}
+	if _, exists := s.sessions[sessionID]; !exists {
+		s.evict(now)
+	}
+	s.sessions[sessionID] = inMemorySession{session: session, expiresAt: now.Add(sessionTTL(s.TTL))}
+	return nil
+}
+
+// evict makes room for a new session if the maximum number of sessions is reached:
+// it removes the expired sessions, or otherwise the session that expires first.
+func (s *InMemorySessionStore) evict(now time.Time) {
+	maxSessions := s.MaxSessions
+	if maxSessions <= 0 {
+		maxSessions = DefaultMaxSessions
+	}
+	if len(s.sessions) < maxSessions {
+		return
+	}
+	var first string
+	for id, entry := range s.sessions {
+		if !now.Before(entry.expiresAt) {
+			delete(s.sessions, id)
+		} else if first == "" || entry.expiresAt.Before(s.sessions[first].expiresAt) {
+			first = id
+		}
+	}
+	if len(s.sessions) >= maxSessions {
+		delete(s.sessions, first)
+	}
+}
+
+var _ SessionStore = &CookieSessionStore{}
+
+// CookieSessionStore stores the session in a cookie, encrypted using AES-GCM.
+// The session is not stored server-side, so it works with multiple application instances that share the same key.
+type CookieSessionStore struct {
+	// CookieName is the name of the session cookie. If not set, DefaultSessionCookieName is used.
+	CookieName string
+	// Key is the AES key used to encrypt the cookie. It must be 16, 24 or 32 bytes long.
+	Key []byte
+	// TTL is the duration a session is valid after it was last saved. If not set, DefaultSessionTTL is used.
+	// The expiry is stored in the encrypted cookie, so expired cookies are rejected even if the user-agent keeps them.
+	TTL time.Duration
+}
+
+// cookieSession is the encrypted content of the session cookie.
+type cookieSession struct {
+	Session   UserSession `json:"session"`
+	ExpiresAt time.Time   `json:"expiresAt"`
+}
+
+func (s CookieSessionStore) Get(httpRequest *http.Request) (*UserSession, error) {
+	cookie, err := httpRequest.Cookie(cookieName(s.CookieName))
+	if err != nil {
+		return nil, nil
+	}
+	ciphertext, err := base64.RawURLEncoding.DecodeString(cookie.Value)
+	if err != nil {
+		return nil, fmt.Errorf("invalid session cookie: %w", err)
+	}
+	aead, err := s.aead()
+	if err != nil {
+		return nil, err
+	}
+	if len(ciphertext) < aead.NonceSize() {
+		return nil, errors.New("invalid session cookie: too short")
+	}
+	plaintext, err := aead.Open(nil, ciphertext[:aead.NonceSize()], ciphertext[aead.NonceSize():], []byte(cookie.Name))
+	if err != nil {
+		return nil, fmt.Errorf("invalid session cookie: %w", err)
+	}
+	var session cookieSession
+	if err := json.Unmarshal(plaintext, &session); err != nil {
+		return nil, fmt.Errorf("invalid session cookie: %w", err)
+	}
+	if !time.Now().Before(session.ExpiresAt) {
+		return nil, nil
+	}
+	return &session.Session, nil
+}
+
+func (s CookieSessionStore) Save(response http.ResponseWriter, _ *http.Request, session UserSession) error {
+	ttl := sessionTTL(s.TTL)
+	plaintext, err := json.Marshal(cookieSession{Session: session, ExpiresAt: time.Now().Add(ttl)})
+	if err != nil {
+		return err
+	}
+	aead, err := s.aead()
+	if err != nil {
+		return err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return err
+	}
+	ciphertext := aead.Seal(nonce, nonce, plaintext, []byte(cookieName(s.CookieName)))
+	cookie := sessionCookie(s.CookieName, base64.RawURLEncoding.EncodeToString(ciphertext))
+	cookie.MaxAge = int(ttl.Seconds())
+	http.SetCookie(response, cookie)
+	return nil
+}
+
+func (s CookieSessionStore) aead() (cipher.AEAD, error) {
+	block, err := aes.NewCipher(s.Key)
+	if err != nil {
+		return nil, fmt.Errorf("session cookie key: %w", err)
+	}
+	return cipher.NewGCM(block)
+}
+
+func sessionTTL(ttl time.Duration) time.Duration {
+	if ttl <= 0 {
+		return DefaultSessionTTL
+	}
+	return ttl
+}
+
+func cookieName(name string) string {
+	if name == "" {
+		return DefaultSessionCookieName
+	}
+	return name
+}
+
+func sessionCookie(name string, value string) *http.Cookie {
+	return &http.Cookie{
+		Name:     cookieName(name),
+		Value:    value,
+		Path:     "/",
+		Secure:   true,
+		HttpOnly: true,
+		// Lax is required, since the user-agent returns to the callback through a cross-site redirect.
+		SameSite: http.SameSiteLaxMode,
+	}
+}
@@ -0,0 +1,178 @@
+package nuts
+
+import (
+	"github.com/nuts-foundation/go-nuts-client/oauth2"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestSessionStores(t *testing.T) {
+	stores := map[string]func() SessionStore{
+		"in-memory": func() SessionStore {
+			return &InMemorySessionStore{}
+		},
+		"cookie": func() SessionStore {
+			return CookieSessionStore{Key: make([]byte, 32)}
+		},
+	}
+	for name, createStore := range stores {
+		t.Run(name, func(t *testing.T) {
+			t.Run("save and get", func(t *testing.T) {
+				store := createStore()
+				expected := UserSession{
+					FlowSessionID: "session",
+					ReturnURL:     "/patients",
+					Token:         &oauth2.Token{AccessToken: "token", TokenType: "Bearer"},
+				}
+				response := httptest.NewRecorder()
+
+				err := store.Save(response, httptest.NewRequest(http.MethodGet, "/", nil), expected)
+				require.NoError(t, err)
+
+				httpRequest := httptest.NewRequest(http.MethodGet, "/", nil)
+				cookies := response.Result().Cookies()
+				require.Len(t, cookies, 1)
+				require.Equal(t, DefaultSessionCookieName, cookies[0].Name)
+				require.True(t, cookies[0].HttpOnly)
+				httpRequest.AddCookie(cookies[0])
+				actual, err := store.Get(httpRequest)
+				require.NoError(t, err)
+				require.Equal(t, expected, *actual)
+			})
+			t.Run("no session", func(t *testing.T) {
+				actual, err := createStore().Get(httptest.NewRequest(http.MethodGet, "/", nil))
+
+				require.NoError(t, err)
+				require.Nil(t, actual)
+			})
+		})
+	}
+}
+
+func TestCookieSessionStore_Get(t *testing.T) {
+	t.Run("tampered cookie", func(t *testing.T) {
+		store := CookieSessionStore{Key: make([]byte, 32)}
+		response := httptest.NewRecorder()
+		require.NoError(t, store.Save(response, nil, UserSession{ReturnURL: "/"}))
+		cookie := response.Result().Cookies()[0]
+		cookie.Value = cookie.Value[:len(cookie.Value)-2] + "AA"
+		httpRequest := httptest.NewRequest(http.MethodGet, "/", nil)
+		httpRequest.AddCookie(cookie)
+
+		_, err := store.Get(httpRequest)
+
+		require.ErrorContains(t, err, "invalid session cookie")
+	})
+	t.Run("other key", func(t *testing.T) {
+		response := httptest.NewRecorder()
+		require.NoError(t, CookieSessionStore{Key: make([]byte, 32)}.Save(response, nil, UserSession{ReturnURL: "/"}))
+		httpRequest := httptest.NewRequest(http.MethodGet, "/", nil)
+		httpRequest.AddCookie(response.Result().Cookies()[0])
+		otherKey := make([]byte, 32)
+		otherKey[0] = 1
+
+		_, err := CookieSessionStore{Key: otherKey}.Get(httpRequest)
+
+		require.ErrorContains(t, err, "invalid session cookie")
+	})
+	t.Run("expired session", func(t *testing.T) {
+		store := CookieSessionStore{Key: make([]byte, 32), TTL: time.Millisecond}
+		response := httptest.NewRecorder()
+		require.NoError(t, store.Save(response, nil, UserSession{ReturnURL: "/"}))
+		httpRequest := httptest.NewRequest(http.MethodGet, "/", nil)
+		httpRequest.AddCookie(response.Result().Cookies()[0])
+
+		time.Sleep(2 * time.Millisecond)
+		actual, err := store.Get(httpRequest)
+
+		require.NoError(t, err)
+		require.Nil(t, actual)
+	})
+	t.Run("cookie max age", func(t *testing.T) {
+		response := httptest.NewRecorder()
+
+		require.NoError(t, CookieSessionStore{Key: make([]byte, 32)}.Save(response, nil, UserSession{ReturnURL: "/"}))
+
+		require.Equal(t, int(DefaultSessionTTL.Seconds()), response.Result().Cookies()[0].MaxAge)
+	})
+	t.Run("invalid key", func(t *testing.T) {
+		err := CookieSessionStore{Key: []byte("short")}.Save(httptest.NewRecorder(), nil, UserSession{})
+
+		require.EqualError(t, err, "session cookie key: crypto/aes: invalid key size 5")
+	})
+}
+
+func TestInMemorySessionStore_Save(t *testing.T) {
+	saveWithCookie := func(store *InMemorySessionStore, cookie *http.Cookie, session UserSession) *http.Cookie {
+		httpRequest := httptest.NewRequest(http.MethodGet, "/", nil)
+		if cookie != nil {
+			httpRequest.AddCookie(cookie)
+		}
+		response := httptest.NewRecorder()
+		require.NoError(t, store.Save(response, httpRequest, session))
+		if cookies := response.Result().Cookies(); len(cookies) > 0 {
+			return cookies[0]
+		}
+		return cookie
+	}
+	get := func(store *InMemorySessionStore, cookie *http.Cookie) *UserSession {
+		httpRequest := httptest.NewRequest(http.MethodGet, "/", nil)
+		httpRequest.AddCookie(cookie)
+		session, err := store.Get(httpRequest)
+		require.NoError(t, err)
+		return session
+	}
+	t.Run("unknown session ID is not reused", func(t *testing.T) {
+		store := &InMemorySessionStore{}
+		planted := &http.Cookie{Name: DefaultSessionCookieName, Value: "planted-by-attacker"}
+
+		cookie := saveWithCookie(store, planted, UserSession{FlowSessionID: "flow"})
+
+		require.NotEqual(t, planted.Value, cookie.Value)
+		require.Nil(t, get(store, planted))
+		require.Equal(t, "flow", get(store, cookie).FlowSessionID)
+	})
+	t.Run("known session ID is reused", func(t *testing.T) {
+		store := &InMemorySessionStore{}
+		cookie := saveWithCookie(store, nil, UserSession{FlowSessionID: "flow"})
+
+		actual := saveWithCookie(store, cookie, UserSession{FlowSessionID: "other-flow"})
+
+		require.Equal(t, cookie.Value, actual.Value)
+		require.Equal(t, "other-flow", get(store, cookie).FlowSessionID)
+	})
+	t.Run("new session ID when token is stored", func(t *testing.T) {
+		store := &InMemorySessionStore{}
+		cookie := saveWithCookie(store, nil, UserSession{FlowSessionID: "flow"})
+
+		actual := saveWithCookie(store, cookie, UserSession{Token: &oauth2.Token{AccessToken: "token"}})
+
+		require.NotEqual(t, cookie.Value, actual.Value)
+		require.Nil(t, get(store, cookie))
+		require.Equal(t, "token", get(store, actual).Token.AccessToken)
+	})
+	t.Run("expired session", func(t *testing.T) {
+		store := &InMemorySessionStore{TTL: time.Millisecond}
+		cookie := saveWithCookie(store, nil, UserSession{FlowSessionID: "flow"})
+
+		time.Sleep(2 * time.Millisecond)
+
+		require.Nil(t, get(store, cookie))
+		require.NotEqual(t, cookie.Value, saveWithCookie(store, cookie, UserSession{}).Value)
+	})
+	t.Run("eviction", func(t *testing.T) {
+		store := &InMemorySessionStore{MaxSessions: 2}
+		first := saveWithCookie(store, nil, UserSession{FlowSessionID: "1"})
+		second := saveWithCookie(store, nil, UserSession{FlowSessionID: "2"})
+
+		third := saveWithCookie(store, nil, UserSession{FlowSessionID: "3"})
+
+		require.Len(t, store.sessions, 2)
+		require.Nil(t, get(store, first))
+		require.NotNil(t, get(store, second))
+		require.NotNil(t, get(store, third))
+	})
+}
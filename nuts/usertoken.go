@@ -0,0 +1,123 @@
+package nuts
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/nuts-foundation/go-nuts-client/nuts/iam"
+	"github.com/nuts-foundation/go-nuts-client/oauth2"
+	"net/http"
+	"time"
+)
+
+// ErrAccessTokenPending is returned when the user access token is not yet available,
+// because the user hasn't finished the authorization flow.
+var ErrAccessTokenPending = errors.New("access token is pending")
+
+// UserDetails returns the employee as preauthorized user for a user access token request.
+func (e EmployeeDetails) UserDetails() iam.UserDetails {
+	return iam.UserDetails{
+		Id:   e.Id,
+		Name: e.Name,
+		Role: e.Role,
+	}
+}
+
+// UserTokenFlow requests user access tokens through the API of a local Nuts node.
+// The flow is started with Start, which returns the URL the user-agent (browser) must be redirected to.
+// After the user-agent has been redirected back to RedirectURI, the access token can be retrieved using the session ID with Retrieve or Wait.
+type UserTokenFlow struct {
+	NutsSubject string
+	// NutsAPIURL is the base URL of the Nuts node API.
+	NutsAPIURL string
+	// NutsHttpClient is the HTTP client used to communicate with the Nuts node.
+	// If not set, http.DefaultClient is used.
+	NutsHttpClient *http.Client
+	// RedirectURI is the URL of the calling application, to which the user-agent is redirected after the flow finished.
+	RedirectURI string
+	// TokenType is the type of access token to request. If not set, a Bearer token is requested.
+	TokenType iam.UserAccessTokenRequestTokenType
+	// PollInterval is the interval at which Wait checks whether the access token is available.
+	// If not set, it defaults to 1 second.
+	PollInterval time.Duration
+}
+
+// Start requests a user access token for the given employee. The user-agent must be redirected to the returned redirect URI,
+// and the returned session ID is used to retrieve the access token when the flow finished.
+func (f UserTokenFlow) Start(ctx context.Context, authzServerURL string, scope string, user EmployeeDetails) (*iam.RedirectResponseWithID, error) {
+	if f.NutsSubject == "" {
+		return nil, errors.New("subject is required")
+	}
+	if f.RedirectURI == "" {
+		return nil, errors.New("redirect URI is required")
+	}
+	if err := user.Validate(); err != nil {
+		return nil, err
+	}
+	client, err := newIAMClient(f.NutsAPIURL, f.NutsHttpClient)
+	if err != nil {
+		return nil, err
+	}
+	tokenType := f.TokenType
+	if tokenType == "" {
+		tokenType = iam.UserAccessTokenRequestTokenTypeBearer
+	}
+	preauthorizedUser := user.UserDetails()
+	httpResponse, err := client.RequestUserAccessToken(ctx, f.NutsSubject, iam.RequestUserAccessTokenJSONRequestBody{
+		AuthorizationServer: authzServerURL,
+		PreauthorizedUser:   &preauthorizedUser,
+		RedirectUri:         f.RedirectURI,
+		Scope:               scope,
+		TokenType:           &tokenType,
+	})
+	response, err := ParseResponse(err, httpResponse, iam.ParseRequestUserAccessTokenResponse)
+	if err != nil {
+		return nil, fmt.Errorf("user access token request: %w", err)
+	}
+	if response.JSON200 == nil {
+		return nil, fmt.Errorf("failed user access token response: %s", response.Status())
+	}
+	return response.JSON200, nil
+}
+
+// Retrieve returns the access token of the given session.
+// If the user hasn't finished the flow yet, ErrAccessTokenPending is returned.
+func (f UserTokenFlow) Retrieve(ctx context.Context, sessionID string) (*oauth2.Token, error) {
+	client, err := newIAMClient(f.NutsAPIURL, f.NutsHttpClient)
+	if err != nil {
+		return nil, err
+	}
+	httpResponse, err := client.RetrieveAccessToken(ctx, sessionID)
+	response, err := ParseResponse(err, httpResponse, iam.ParseRetrieveAccessTokenResponse)
+	if err != nil {
+		return nil, fmt.Errorf("user access token retrieval: %w", err)
+	}
+	if response.JSON200 == nil {
+		return nil, fmt.Errorf("failed user access token response: %s", response.Status())
+	}
+	if response.JSON200.Status != nil && *response.JSON200.Status == iam.Pending {
+		return nil, ErrAccessTokenPending
+	}
+	return toOAuth2Token(*response.JSON200), nil
+}
+
+// Wait polls the Nuts node until the access token of the given session becomes active, or the context is cancelled.
+func (f UserTokenFlow) Wait(ctx context.Context, sessionID string) (*oauth2.Token, error) {
+	interval := f.PollInterval
+	if interval <= 0 {
+		interval = time.Second
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		token, err := f.Retrieve(ctx, sessionID)
+		if !errors.Is(err, ErrAccessTokenPending) {
+			return token, err
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,138 @@
+package nuts
+
+import (
+	"context"
+	"errors"
+	"github.com/nuts-foundation/go-nuts-client/oauth2"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// UserTokenHandler provides HTTP handlers that obtain user access tokens through the user-agent (browser), using UserTokenFlow.
+// The handler registered at the Flow's RedirectURI must be CallbackHandler.
+type UserTokenHandler struct {
+	Flow  UserTokenFlow
+	Store SessionStore
+	// AuthzServerURL is the URL of the OAuth2 Authorization Server the access token is requested from.
+	AuthzServerURL string
+	// Scope is the scope of the requested access token.
+	Scope string
+	// Employee returns the details of the user that is logged in to the application.
+	Employee func(httpRequest *http.Request) (EmployeeDetails, error)
+}
+
+// StartHandler returns a handler that starts the flow and redirects the user-agent.
+// When the flow finished, the user-agent is redirected to the (relative) URL in the return_to query parameter, or / if not set.
+func (h UserTokenHandler) StartHandler() http.Handler {
+	return http.HandlerFunc(func(response http.ResponseWriter, httpRequest *http.Request) {
+		returnURL := httpRequest.URL.Query().Get("return_to")
+		if !isRelativeURL(returnURL) {
+			returnURL = "/"
+		}
+		h.start(response, httpRequest, returnURL)
+	})
+}
+
+// CallbackHandler returns a handler that retrieves the access token when the user-agent returns from the flow.
+// It stores the access token in the session and redirects the user-agent to the URL it originally requested.
+func (h UserTokenHandler) CallbackHandler() http.Handler {
+	return http.HandlerFunc(func(response http.ResponseWriter, httpRequest *http.Request) {
+		session, err := h.Store.Get(httpRequest)
+		if err != nil {
+			http.Error(response, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if session == nil || session.FlowSessionID == "" {
+			http.Error(response, "no pending user access token request", http.StatusBadRequest)
+			return
+		}
+		// The Nuts node might not have activated the access token yet when the user-agent returns,
+		// so wait for it as long as the user-agent waits for the response.
+		token, err := h.Flow.Wait(httpRequest.Context(), session.FlowSessionID)
+		if err != nil {
+			http.Error(response, err.Error(), http.StatusBadGateway)
+			return
+		}
+		session.FlowSessionID = ""
+		session.Token = token
+		if err := h.Store.Save(response, httpRequest, *session); err != nil {
+			http.Error(response, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		returnURL := session.ReturnURL
+		if returnURL == "" {
+			returnURL = "/"
+		}
+		http.Redirect(response, httpRequest, returnURL, http.StatusFound)
+	})
+}
+
+// Middleware returns a middleware that requires a user access token for the wrapped handler.
+// If the session doesn't contain a valid access token, the flow is started and the request is resumed when the flow finished.
+// Otherwise, the access token is available to the wrapped handler through UserAccessToken.
+func (h UserTokenHandler) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(response http.ResponseWriter, httpRequest *http.Request) {
+		session, err := h.Store.Get(httpRequest)
+		if err != nil {
+			http.Error(response, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if session == nil || !isTokenValid(session.Token) {
+			h.start(response, httpRequest, httpRequest.URL.RequestURI())
+			return
+		}
+		next.ServeHTTP(response, httpRequest.WithContext(context.WithValue(httpRequest.Context(), userAccessTokenKey, session.Token)))
+	})
+}
+
+func (h UserTokenHandler) start(response http.ResponseWriter, httpRequest *http.Request, returnURL string) {
+	if h.Employee == nil {
+		http.Error(response, "employee details not configured", http.StatusInternalServerError)
+		return
+	}
+	employee, err := h.Employee(httpRequest)
+	if err != nil {
+		http.Error(response, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	redirect, err := h.Flow.Start(httpRequest.Context(), h.AuthzServerURL, h.Scope, employee)
+	if err != nil {
+		http.Error(response, err.Error(), http.StatusBadGateway)
+		return
+	}
+	err = h.Store.Save(response, httpRequest, UserSession{
+		FlowSessionID: redirect.SessionId,
+		ReturnURL:     returnURL,
+	})
+	if err != nil {
+		http.Error(response, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	http.Redirect(response, httpRequest, redirect.RedirectUri, http.StatusFound)
+}
+
+type userAccessTokenKeyType struct{}
+
+var userAccessTokenKey = userAccessTokenKeyType{}
+
+// UserAccessToken returns the user access token set by UserTokenHandler.Middleware.
+func UserAccessToken(ctx context.Context) (*oauth2.Token, error) {
+	token, ok := ctx.Value(userAccessTokenKey).(*oauth2.Token)
+	if !ok {
+		return nil, errors.New("no user access token in context")
+	}
+	return token, nil
+}
+
+func isTokenValid(token *oauth2.Token) bool {
+	if token == nil || token.AccessToken == "" {
+		return false
+	}
+	return token.Expiry == nil || token.Expiry.After(time.Now())
+}
+
+// isRelativeURL checks whether the URL is a path on the same host, to prevent open redirects.
+func isRelativeURL(u string) bool {
+	return strings.HasPrefix(u, "/") && !strings.HasPrefix(u, "//") && !strings.HasPrefix(u, "/\\")
+}
@@ -0,0 +1,145 @@
+package nuts
+
+import (
+	"errors"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestUserTokenHandler(t *testing.T) {
+	nodeMux := http.NewServeMux()
+	nodeMux.HandleFunc("POST /internal/auth/v2/123abc/request-user-access-token", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte(`{"redirect_uri":"https://node.example.com/authorize","session_id":"session"}`))
+	})
+	nodeMux.HandleFunc("GET /internal/auth/v2/accesstoken/session", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte(`{"access_token":"test","token_type":"Bearer","expires_in":3600,"status":"active"}`))
+	})
+	nodeServer := httptest.NewServer(nodeMux)
+	handler := UserTokenHandler{
+		Flow: UserTokenFlow{
+			NutsSubject: "123abc",
+			NutsAPIURL:  nodeServer.URL,
+			RedirectURI: "https://app.example.com/callback",
+		},
+		Store:          CookieSessionStore{Key: make([]byte, 32)},
+		AuthzServerURL: "https://auth.example.com",
+		Scope:          "test",
+		Employee: func(_ *http.Request) (EmployeeDetails, error) {
+			return EmployeeDetails{Id: "1", Name: "John", Role: "Nurse"}, nil
+		},
+	}
+	protected := handler.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, err := UserAccessToken(r.Context())
+		require.NoError(t, err)
+		_, _ = w.Write([]byte(token.AccessToken))
+	}))
+
+	t.Run("middleware starts flow, callback resumes original request", func(t *testing.T) {
+		// Request to protected resource, without session: redirect to Nuts node
+		response := httptest.NewRecorder()
+		protected.ServeHTTP(response, httptest.NewRequest(http.MethodGet, "/patients?id=1", nil))
+		require.Equal(t, http.StatusFound, response.Code)
+		require.Equal(t, "https://node.example.com/authorize", response.Header().Get("Location"))
+		sessionCookie := response.Result().Cookies()[0]
+
+		// User-agent returns at callback: token is retrieved and user-agent is redirected to original URL
+		response = httptest.NewRecorder()
+		httpRequest := httptest.NewRequest(http.MethodGet, "/callback", nil)
+		httpRequest.AddCookie(sessionCookie)
+		handler.CallbackHandler().ServeHTTP(response, httpRequest)
+		require.Equal(t, http.StatusFound, response.Code)
+		require.Equal(t, "/patients?id=1", response.Header().Get("Location"))
+		sessionCookie = response.Result().Cookies()[0]
+
+		// Original request is resumed
+		response = httptest.NewRecorder()
+		httpRequest = httptest.NewRequest(http.MethodGet, "/patients?id=1", nil)
+		httpRequest.AddCookie(sessionCookie)
+		protected.ServeHTTP(response, httpRequest)
+		require.Equal(t, http.StatusOK, response.Code)
+		require.Equal(t, "test", response.Body.String())
+	})
+	t.Run("start handler", func(t *testing.T) {
+		t.Run("return_to", func(t *testing.T) {
+			response := httptest.NewRecorder()
+			handler.StartHandler().ServeHTTP(response, httptest.NewRequest(http.MethodGet, "/start?return_to=/patients", nil))
+			require.Equal(t, http.StatusFound, response.Code)
+
+			httpRequest := httptest.NewRequest(http.MethodGet, "/", nil)
+			httpRequest.AddCookie(response.Result().Cookies()[0])
+			session, err := handler.Store.Get(httpRequest)
+			require.NoError(t, err)
+			require.Equal(t, "/patients", session.ReturnURL)
+			require.Equal(t, "session", session.FlowSessionID)
+		})
+		t.Run("return_to is not relative", func(t *testing.T) {
+			response := httptest.NewRecorder()
+			handler.StartHandler().ServeHTTP(response, httptest.NewRequest(http.MethodGet, "/start?return_to=//evil.example.com", nil))
+
+			httpRequest := httptest.NewRequest(http.MethodGet, "/", nil)
+			httpRequest.AddCookie(response.Result().Cookies()[0])
+			session, err := handler.Store.Get(httpRequest)
+			require.NoError(t, err)
+			require.Equal(t, "/", session.ReturnURL)
+		})
+		t.Run("employee unknown", func(t *testing.T) {
+			handler := handler
+			handler.Employee = func(_ *http.Request) (EmployeeDetails, error) {
+				return EmployeeDetails{}, errors.New("not logged in")
+			}
+			response := httptest.NewRecorder()
+
+			handler.StartHandler().ServeHTTP(response, httptest.NewRequest(http.MethodGet, "/start", nil))
+
+			require.Equal(t, http.StatusUnauthorized, response.Code)
+		})
+	})
+	t.Run("callback waits for pending access token", func(t *testing.T) {
+		nodeMux := http.NewServeMux()
+		nodeMux.HandleFunc("POST /internal/auth/v2/123abc/request-user-access-token", func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusOK)
+			_, _ = w.Write([]byte(`{"redirect_uri":"https://node.example.com/authorize","session_id":"session"}`))
+		})
+		var retrievals int
+		nodeMux.HandleFunc("GET /internal/auth/v2/accesstoken/session", func(w http.ResponseWriter, r *http.Request) {
+			retrievals++
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusOK)
+			if retrievals == 1 {
+				_, _ = w.Write([]byte(`{"access_token":"","token_type":"Bearer","status":"pending"}`))
+				return
+			}
+			_, _ = w.Write([]byte(`{"access_token":"test","token_type":"Bearer","expires_in":3600,"status":"active"}`))
+		})
+		nodeServer := httptest.NewServer(nodeMux)
+		handler := handler
+		handler.Flow.NutsAPIURL = nodeServer.URL
+		handler.Flow.PollInterval = time.Millisecond
+		response := httptest.NewRecorder()
+		handler.StartHandler().ServeHTTP(response, httptest.NewRequest(http.MethodGet, "/start?return_to=/patients", nil))
+		httpRequest := httptest.NewRequest(http.MethodGet, "/callback", nil)
+		httpRequest.AddCookie(response.Result().Cookies()[0])
+		response = httptest.NewRecorder()
+
+		handler.CallbackHandler().ServeHTTP(response, httpRequest)
+
+		require.Equal(t, http.StatusFound, response.Code)
+		require.Equal(t, "/patients", response.Header().Get("Location"))
+		require.Equal(t, 2, retrievals)
+	})
+	t.Run("callback without pending flow", func(t *testing.T) {
+		response := httptest.NewRecorder()
+
+		handler.CallbackHandler().ServeHTTP(response, httptest.NewRequest(http.MethodGet, "/callback", nil))
+
+		require.Equal(t, http.StatusBadRequest, response.Code)
+	})
+}
@@ -0,0 +1,138 @@
+package nuts
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/nuts-foundation/go-nuts-client/nuts/iam"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestUserTokenFlow_Start(t *testing.T) {
+	employee := EmployeeDetails{Id: "1", Name: "John", Role: "Nurse"}
+	t.Run("ok", func(t *testing.T) {
+		mux := http.NewServeMux()
+		var capturedRequest iam.UserAccessTokenRequest
+		mux.HandleFunc("POST /internal/auth/v2/123abc/request-user-access-token", func(w http.ResponseWriter, r *http.Request) {
+			require.NoError(t, json.NewDecoder(r.Body).Decode(&capturedRequest))
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusOK)
+			_, _ = w.Write([]byte(`{"redirect_uri":"https://node.example.com/authorize","session_id":"session"}`))
+		})
+		httpServer := httptest.NewServer(mux)
+		flow := UserTokenFlow{
+			NutsSubject: "123abc",
+			NutsAPIURL:  httpServer.URL,
+			RedirectURI: "https://app.example.com/callback",
+		}
+
+		response, err := flow.Start(context.Background(), "https://auth.example.com", "test", employee)
+
+		require.NoError(t, err)
+		require.Equal(t, "https://node.example.com/authorize", response.RedirectUri)
+		require.Equal(t, "session", response.SessionId)
+		require.Equal(t, employee.UserDetails(), *capturedRequest.PreauthorizedUser)
+		require.Equal(t, "https://app.example.com/callback", capturedRequest.RedirectUri)
+		require.Equal(t, "https://auth.example.com", capturedRequest.AuthorizationServer)
+		require.Equal(t, iam.UserAccessTokenRequestTokenTypeBearer, *capturedRequest.TokenType)
+		t.Run("DPoP", func(t *testing.T) {
+			flow.TokenType = iam.UserAccessTokenRequestTokenTypeDPoP
+
+			_, err := flow.Start(context.Background(), "https://auth.example.com", "test", employee)
+
+			require.NoError(t, err)
+			require.Equal(t, iam.UserAccessTokenRequestTokenTypeDPoP, *capturedRequest.TokenType)
+		})
+	})
+	t.Run("invalid employee", func(t *testing.T) {
+		flow := UserTokenFlow{
+			NutsSubject: "123abc",
+			RedirectURI: "https://app.example.com/callback",
+		}
+
+		_, err := flow.Start(context.Background(), "https://auth.example.com", "test", EmployeeDetails{})
+
+		require.ErrorContains(t, err, "invalid EmployeeCredential")
+	})
+	t.Run("error response", func(t *testing.T) {
+		httpServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/problem+json")
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(`{"title":"bad request"}`))
+		}))
+		flow := UserTokenFlow{
+			NutsSubject: "123abc",
+			NutsAPIURL:  httpServer.URL,
+			RedirectURI: "https://app.example.com/callback",
+		}
+
+		_, err := flow.Start(context.Background(), "https://auth.example.com", "test", employee)
+
+		require.ErrorContains(t, err, "user access token request: non-OK status code (status=400 Bad Request")
+	})
+}
+
+func TestUserTokenFlow_Wait(t *testing.T) {
+	t.Run("pending, then active", func(t *testing.T) {
+		var calls atomic.Int32
+		mux := http.NewServeMux()
+		mux.HandleFunc("GET /internal/auth/v2/accesstoken/session", func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusOK)
+			if calls.Add(1) < 3 {
+				_, _ = w.Write([]byte(`{"access_token":"","token_type":"","status":"pending"}`))
+				return
+			}
+			_, _ = w.Write([]byte(`{"access_token":"test","token_type":"Bearer","expires_in":3600,"status":"active"}`))
+		})
+		httpServer := httptest.NewServer(mux)
+		flow := UserTokenFlow{
+			NutsAPIURL:   httpServer.URL,
+			PollInterval: time.Millisecond,
+		}
+
+		token, err := flow.Wait(context.Background(), "session")
+
+		require.NoError(t, err)
+		require.Equal(t, "test", token.AccessToken)
+		require.Equal(t, "Bearer", token.TokenType)
+		require.NotNil(t, token.Expiry)
+		require.Equal(t, int32(3), calls.Load())
+	})
+	t.Run("context cancelled", func(t *testing.T) {
+		httpServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusOK)
+			_, _ = w.Write([]byte(`{"access_token":"","token_type":"","status":"pending"}`))
+		}))
+		flow := UserTokenFlow{
+			NutsAPIURL:   httpServer.URL,
+			PollInterval: time.Millisecond,
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		defer cancel()
+
+		_, err := flow.Wait(ctx, "session")
+
+		require.ErrorIs(t, err, context.DeadlineExceeded)
+	})
+}
+
+func TestUserTokenFlow_Retrieve(t *testing.T) {
+	t.Run("pending", func(t *testing.T) {
+		httpServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusOK)
+			_, _ = w.Write([]byte(`{"access_token":"","token_type":"","status":"pending"}`))
+		}))
+		flow := UserTokenFlow{NutsAPIURL: httpServer.URL}
+
+		_, err := flow.Retrieve(context.Background(), "session")
+
+		require.ErrorIs(t, err, ErrAccessTokenPending)
+	})
+}
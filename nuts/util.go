@@ -6,6 +6,7 @@ import (
 	"io"
 	"net"
 	"net/http"
+	"sort"
 	"strings"
 )
 
@@ -36,3 +37,21 @@ func ParseResponse[T any](err error, httpResponse *http.Response, fn func(rsp *h
 	}
 	return result, nil
 }
+
+// ParseOptionalJSONResponse is like ParseResponse, but also accepts successful responses without (JSON) body.
+func ParseOptionalJSONResponse[T any](err error, httpResponse *http.Response, fn func(rsp *http.Response) (*T, error)) (*T, error) {
+	if err == nil && httpResponse.StatusCode >= 200 && httpResponse.StatusCode < 300 && httpResponse.Header.Get("Content-Type") == "" {
+		return fn(httpResponse)
+	}
+	return ParseResponse(err, httpResponse, fn)
+}
+
+// SortedKeys returns the keys of the map in ascending order, to iterate over it deterministically.
+func SortedKeys[V any](m map[string]V) []string {
+	result := make([]string, 0, len(m))
+	for key := range m {
+		result = append(result, key)
+	}
+	sort.Strings(result)
+	return result
+}
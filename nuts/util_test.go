@@ -63,3 +63,8 @@ func Test_ParseResponse(t *testing.T) {
 		require.EqualError(t, err, "unexpected response content type: text/plain")
 	})
 }
+
+func TestSortedKeys(t *testing.T) {
+	require.Equal(t, []string{"a", "b", "c"}, SortedKeys(map[string]int{"c": 3, "a": 1, "b": 2}))
+	require.Empty(t, SortedKeys(map[string]int(nil)))
+}
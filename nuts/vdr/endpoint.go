@@ -0,0 +1,160 @@
+package vdr
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/nuts-foundation/go-nuts-client/nuts"
+	"net/url"
+)
+
+// ParseEndpointURL parses a service endpoint URL, which must be an absolute HTTPS URL without fragment.
+func ParseEndpointURL(value string) (*url.URL, error) {
+	result, err := url.Parse(value)
+	if err != nil || !result.IsAbs() || result.Host == "" {
+		return nil, fmt.Errorf("invalid service endpoint URL: %s", value)
+	}
+	if result.Scheme != "https" {
+		return nil, fmt.Errorf("service endpoint URL must use https: %s", value)
+	}
+	if result.Fragment != "" || result.RawFragment != "" {
+		return nil, fmt.Errorf("service endpoint URL can't contain a fragment: %s", value)
+	}
+	return result, nil
+}
+
+// DecodeEndpointURL decodes a service endpoint that is a URL, or an array of which the first valid URL is used (see ParseEndpointURL).
+func DecodeEndpointURL(endpoint interface{}) (*url.URL, error) {
+	if _, ok := endpoint.(map[string]interface{}); ok {
+		return nil, fmt.Errorf("service endpoint is not a URL: %v", endpoint)
+	}
+	return selectEndpointURL(endpoint, "", ParseEndpointURL)
+}
+
+// DecodeEndpointURLs decodes a service endpoint that is an array of URLs (or a single URL), see ParseEndpointURL.
+func DecodeEndpointURLs(endpoint interface{}) ([]*url.URL, error) {
+	if _, ok := endpoint.(string); ok {
+		endpoint = []interface{}{endpoint}
+	}
+	array, ok := endpoint.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("service endpoint is not an array of URLs: %v", endpoint)
+	}
+	result := make([]*url.URL, 0, len(array))
+	for _, item := range array {
+		value, ok := item.(string)
+		if !ok {
+			return nil, fmt.Errorf("service endpoint is not an array of URLs: %v", endpoint)
+		}
+		u, err := ParseEndpointURL(value)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, u)
+	}
+	return result, nil
+}
+
+// DecodeEndpoint decodes a service endpoint that is an object into the target, e.g. a struct with JSON tags that match the object's keys.
+// Values of the object that are absolute URLs are validated (see ParseEndpointURL).
+func DecodeEndpoint(endpoint interface{}, target interface{}) error {
+	object, ok := endpoint.(map[string]interface{})
+	if !ok {
+		return fmt.Errorf("service endpoint is not an object: %v", endpoint)
+	}
+	for _, key := range nuts.SortedKeys(object) {
+		value, ok := object[key].(string)
+		if !ok {
+			continue
+		}
+		if u, err := url.Parse(value); err == nil && u.IsAbs() && u.Host != "" {
+			if _, err := ParseEndpointURL(value); err != nil {
+				return fmt.Errorf("service endpoint %s: %w", key, err)
+			}
+		}
+	}
+	data, err := json.Marshal(object)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, target)
+}
+
+// ResolveEndpoint returns the URL of the subject's service of the given type. If the service endpoint is an object,
+// the key specifies the URL to return; if not specified, the object must contain exactly one URL.
+// If the endpoint is an array, its first valid URL is returned.
+// The subject's DIDs must all specify the same URL.
+func ResolveEndpoint(ctx context.Context, client ClientInterface, subjectID string, serviceType string, key string) (*url.URL, error) {
+	return resolveEndpoint(ctx, client, subjectID, serviceType, key, ParseEndpointURL)
+}
+
+func resolveEndpoint(ctx context.Context, client ClientInterface, subjectID string, serviceType string, key string, parse func(string) (*url.URL, error)) (*url.URL, error) {
+	httpResponse, err := client.FindServices(ctx, subjectID, &FindServicesParams{Type: &serviceType})
+	response, err := nuts.ParseResponse(err, httpResponse, ParseFindServicesResponse)
+	if err != nil {
+		return nil, fmt.Errorf("find services of subject %s: %w", subjectID, err)
+	}
+	if response.JSON200 == nil {
+		return nil, fmt.Errorf("failed find services of subject %s response: %s", subjectID, response.Status())
+	}
+	return serviceEndpointURL("subject "+subjectID, *response.JSON200, serviceType, key, parse)
+}
+
+// serviceEndpointURL returns the URL of the services of the given type (see selectEndpointURL) of the owner (a DID or subject),
+// which must all specify the same URL.
+func serviceEndpointURL(owner string, services []Service, serviceType string, key string, parse func(string) (*url.URL, error)) (*url.URL, error) {
+	var result *url.URL
+	for _, service := range services {
+		if service.Type != serviceType {
+			continue
+		}
+		endpoint, err := selectEndpointURL(service.ServiceEndpoint, key, parse)
+		if err != nil {
+			return nil, fmt.Errorf("service %s: %w", service.Id, err)
+		}
+		if result != nil && result.String() != endpoint.String() {
+			return nil, fmt.Errorf("%s has multiple %s services with different endpoints", owner, serviceType)
+		}
+		result = endpoint
+	}
+	if result == nil {
+		return nil, fmt.Errorf("%s has no %s service", owner, serviceType)
+	}
+	return result, nil
+}
+
+// selectEndpointURL returns the URL of a service endpoint, parsed with the given function: the URL itself,
+// the first valid URL of an array, or the URL under the key of an object (or its only URL if no key is specified).
+func selectEndpointURL(endpoint interface{}, key string, parse func(string) (*url.URL, error)) (*url.URL, error) {
+	switch value := endpoint.(type) {
+	case string:
+		return parse(value)
+	case []interface{}:
+		for _, item := range value {
+			if result, err := selectEndpointURL(item, key, parse); err == nil {
+				return result, nil
+			}
+		}
+		return nil, errors.New("service endpoint array doesn't contain a valid URL")
+	case map[string]interface{}:
+		if key != "" {
+			if _, ok := value[key]; !ok {
+				return nil, fmt.Errorf("service endpoint doesn't contain %s", key)
+			}
+			return selectEndpointURL(value[key], "", parse)
+		}
+		var keys []string
+		for _, curr := range nuts.SortedKeys(value) {
+			if _, ok := value[curr].(string); ok {
+				keys = append(keys, curr)
+			}
+		}
+		if len(keys) != 1 {
+			return nil, fmt.Errorf("service endpoint must contain exactly one URL, got %v", keys)
+		}
+		return selectEndpointURL(value[keys[0]], "", parse)
+	default:
+		return nil, fmt.Errorf("unsupported service endpoint: %v", endpoint)
+	}
+}
@@ -0,0 +1,188 @@
+package vdr
+
+import (
+	"context"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+func TestParseEndpointURL(t *testing.T) {
+	t.Run("ok", func(t *testing.T) {
+		actual, err := ParseEndpointURL("https://example.com/fhir")
+
+		require.NoError(t, err)
+		require.Equal(t, "https://example.com/fhir", actual.String())
+	})
+	t.Run("relative URL", func(t *testing.T) {
+		_, err := ParseEndpointURL("/fhir")
+
+		require.EqualError(t, err, "invalid service endpoint URL: /fhir")
+	})
+	t.Run("http", func(t *testing.T) {
+		_, err := ParseEndpointURL("http://example.com/fhir")
+
+		require.EqualError(t, err, "service endpoint URL must use https: http://example.com/fhir")
+	})
+	t.Run("fragment", func(t *testing.T) {
+		_, err := ParseEndpointURL("https://example.com/fhir#metadata")
+
+		require.EqualError(t, err, "service endpoint URL can't contain a fragment: https://example.com/fhir#metadata")
+	})
+}
+
+func TestDecodeEndpointURL(t *testing.T) {
+	t.Run("string", func(t *testing.T) {
+		actual, err := DecodeEndpointURL("https://example.com/fhir")
+
+		require.NoError(t, err)
+		require.Equal(t, "https://example.com/fhir", actual.String())
+	})
+	t.Run("single-element array", func(t *testing.T) {
+		actual, err := DecodeEndpointURL([]interface{}{"https://example.com/fhir"})
+
+		require.NoError(t, err)
+		require.Equal(t, "https://example.com/fhir", actual.String())
+	})
+	t.Run("array", func(t *testing.T) {
+		actual, err := DecodeEndpointURL([]interface{}{"http://example.com/fhir", "https://a.example.com/fhir", "https://b.example.com/fhir"})
+
+		require.NoError(t, err)
+		require.Equal(t, "https://a.example.com/fhir", actual.String())
+	})
+	t.Run("array without valid URL", func(t *testing.T) {
+		_, err := DecodeEndpointURL([]interface{}{"http://example.com/fhir"})
+
+		require.EqualError(t, err, "service endpoint array doesn't contain a valid URL")
+	})
+	t.Run("object", func(t *testing.T) {
+		_, err := DecodeEndpointURL(map[string]interface{}{"url": "https://example.com/fhir"})
+
+		require.EqualError(t, err, "service endpoint is not a URL: map[url:https://example.com/fhir]")
+	})
+}
+
+func TestDecodeEndpointURLs(t *testing.T) {
+	t.Run("array", func(t *testing.T) {
+		actual, err := DecodeEndpointURLs([]interface{}{"https://a.example.com", "https://b.example.com"})
+
+		require.NoError(t, err)
+		require.Len(t, actual, 2)
+		require.Equal(t, "https://b.example.com", actual[1].String())
+	})
+	t.Run("string", func(t *testing.T) {
+		actual, err := DecodeEndpointURLs("https://a.example.com")
+
+		require.NoError(t, err)
+		require.Len(t, actual, 1)
+	})
+	t.Run("invalid URL", func(t *testing.T) {
+		_, err := DecodeEndpointURLs([]interface{}{"https://a.example.com", "http://b.example.com"})
+
+		require.EqualError(t, err, "service endpoint URL must use https: http://b.example.com")
+	})
+}
+
+func TestDecodeEndpoint(t *testing.T) {
+	type notificationEndpoint struct {
+		URL    string `json:"url"`
+		Weight int    `json:"weight"`
+	}
+	t.Run("ok", func(t *testing.T) {
+		var actual notificationEndpoint
+
+		err := DecodeEndpoint(map[string]interface{}{"url": "https://example.com/notify", "weight": 1.0}, &actual)
+
+		require.NoError(t, err)
+		require.Equal(t, notificationEndpoint{URL: "https://example.com/notify", Weight: 1}, actual)
+	})
+	t.Run("invalid URL", func(t *testing.T) {
+		var actual notificationEndpoint
+
+		err := DecodeEndpoint(map[string]interface{}{"url": "http://example.com/notify"}, &actual)
+
+		require.EqualError(t, err, "service endpoint url: service endpoint URL must use https: http://example.com/notify")
+	})
+	t.Run("not an object", func(t *testing.T) {
+		var actual notificationEndpoint
+
+		err := DecodeEndpoint("https://example.com/notify", &actual)
+
+		require.EqualError(t, err, "service endpoint is not an object: https://example.com/notify")
+	})
+}
+
+func Test_selectEndpointURL(t *testing.T) {
+	t.Run("object without key", func(t *testing.T) {
+		actual, err := selectEndpointURL(map[string]interface{}{"url": "https://example.com"}, "", ParseEndpointURL)
+
+		require.NoError(t, err)
+		require.Equal(t, "https://example.com", actual.String())
+	})
+	t.Run("object with multiple URLs", func(t *testing.T) {
+		_, err := selectEndpointURL(map[string]interface{}{"b": "https://b.example.com", "a": "https://a.example.com"}, "", ParseEndpointURL)
+
+		require.EqualError(t, err, "service endpoint must contain exactly one URL, got [a b]")
+	})
+	t.Run("object without key value", func(t *testing.T) {
+		_, err := selectEndpointURL(map[string]interface{}{"url": "https://example.com"}, "base", ParseEndpointURL)
+
+		require.EqualError(t, err, "service endpoint doesn't contain base")
+	})
+	t.Run("relative URL", func(t *testing.T) {
+		_, err := selectEndpointURL("/oauth2", "", ParseEndpointURL)
+
+		require.EqualError(t, err, "invalid service endpoint URL: /oauth2")
+	})
+	t.Run("unsupported", func(t *testing.T) {
+		_, err := selectEndpointURL(1.0, "", ParseEndpointURL)
+
+		require.EqualError(t, err, "unsupported service endpoint: 1")
+	})
+}
+
+func TestResolveEndpoint(t *testing.T) {
+	handler := http.NewServeMux()
+	handler.HandleFunc("GET /internal/vdr/v2/subject/{id}/service", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		switch r.URL.Query().Get("type") {
+		case "fhir":
+			_, _ = w.Write([]byte(`[
+  {"id": "did:web:a#fhir", "type": "fhir", "serviceEndpoint": {"base": "https://example.com/fhir", "metadata": "https://example.com/fhir/metadata"}},
+  {"id": "did:nuts:a#fhir", "type": "fhir", "serviceEndpoint": {"base": "https://example.com/fhir", "metadata": "https://example.com/fhir/metadata"}}
+]`))
+		case "notification":
+			_, _ = w.Write([]byte(`[{"id": "did:web:a#notification", "type": "notification", "serviceEndpoint": ["https://example.com/notify", "https://backup.example.com/notify"]}]`))
+		default:
+			_, _ = w.Write([]byte(`[]`))
+		}
+	})
+	httpServer := httptest.NewServer(handler)
+	client, _ := NewClient(httpServer.URL)
+
+	t.Run("object", func(t *testing.T) {
+		actual, err := ResolveEndpoint(context.Background(), client, "a", "fhir", "base")
+
+		require.NoError(t, err)
+		require.Equal(t, &url.URL{Scheme: "https", Host: "example.com", Path: "/fhir"}, actual)
+	})
+	t.Run("object without key", func(t *testing.T) {
+		_, err := ResolveEndpoint(context.Background(), client, "a", "fhir", "")
+
+		require.EqualError(t, err, "service did:web:a#fhir: service endpoint must contain exactly one URL, got [base metadata]")
+	})
+	t.Run("array", func(t *testing.T) {
+		actual, err := ResolveEndpoint(context.Background(), client, "a", "notification", "")
+
+		require.NoError(t, err)
+		require.Equal(t, "https://example.com/notify", actual.String())
+	})
+	t.Run("no such service", func(t *testing.T) {
+		_, err := ResolveEndpoint(context.Background(), client, "a", "other", "")
+
+		require.EqualError(t, err, "subject a has no other service")
+	})
+}
@@ -0,0 +1,137 @@
+package vdr
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/nuts-foundation/go-did/did"
+	"github.com/nuts-foundation/go-nuts-client/nuts"
+	"github.com/nuts-foundation/go-nuts-client/oauth2"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// DefaultAuthorizationServerServiceType is the DID document service type that holds the Authorization Server URL
+// if AuthorizationServerLocator.ServiceType is not set.
+const DefaultAuthorizationServerServiceType = "oauth-authorization-server"
+
+// DefaultLocatorCacheTTL is the duration an AuthorizationServerLocator caches the Authorization Servers of local subjects
+// if AuthorizationServerLocator.CacheTTL is not set.
+const DefaultLocatorCacheTTL = 5 * time.Minute
+
+// AuthorizationServerLocator locates the OAuth2 Authorization Server of a partner through a service in its DID document.
+// The partner is specified in the request context: a DID (see nuts.WithPartnerDID), which is resolved,
+// or a subject on the local Nuts node (see nuts.WithPartnerSubject), of which the services are searched.
+// The service endpoint can be a URL, an array (of which the first valid URL is used) or an object (see EndpointKey).
+//
+// Add its Locate method to oauth2.Transport.AuthzServerLocators. It must not be copied after first use.
+type AuthorizationServerLocator struct {
+	// Client is the client of the VDR API of the Nuts node.
+	Client ClientInterface
+	// ServiceType is the type of the service that holds the Authorization Server URL.
+	// If not set, DefaultAuthorizationServerServiceType is used.
+	ServiceType string
+	// EndpointKey is the key of the Authorization Server URL in service endpoints that are an object.
+	// If not set, the object must contain exactly one URL.
+	EndpointKey string
+	// Resolver optionally resolves (and caches) the DID documents of partners, e.g. to share it with other components.
+	// If not set, a CachingResolver with CacheTTL as TTL is used.
+	Resolver *CachingResolver
+	// CacheTTL is the duration the located Authorization Servers of local subjects are cached, and the TTL of the default Resolver.
+	// If not set, DefaultLocatorCacheTTL is used.
+	CacheTTL time.Duration
+
+	mux      sync.Mutex
+	resolver *CachingResolver
+	cache    map[string]locatorCacheEntry
+}
+
+type locatorCacheEntry struct {
+	authServerURL *url.URL
+	expiresAt     time.Time
+}
+
+var _ oauth2.AuthorizationServerLocator = (&AuthorizationServerLocator{}).Locate
+
+// Locate returns the URL of the Authorization Server of the partner specified in the request context,
+// or nil if no partner is specified.
+func (l *AuthorizationServerLocator) Locate(_ *oauth2.MetadataLoader, response *http.Response) (*url.URL, error) {
+	ctx := response.Request.Context()
+	if id := nuts.PartnerDID(ctx); id != "" {
+		return l.locateByDID(ctx, id)
+	}
+	subjectID := nuts.PartnerSubject(ctx)
+	if subjectID == "" {
+		return nil, nil
+	}
+	l.mux.Lock()
+	entry, ok := l.cache[subjectID]
+	l.mux.Unlock()
+	if ok && time.Now().Before(entry.expiresAt) {
+		return entry.authServerURL, nil
+	}
+	authServerURL, err := resolveEndpoint(ctx, l.Client, subjectID, l.serviceType(), l.EndpointKey, parseAbsoluteURL)
+	if err != nil {
+		return nil, err
+	}
+	l.mux.Lock()
+	defer l.mux.Unlock()
+	if l.cache == nil {
+		l.cache = make(map[string]locatorCacheEntry)
+	}
+	l.cache[subjectID] = locatorCacheEntry{authServerURL: authServerURL, expiresAt: time.Now().Add(l.cacheTTL())}
+	return authServerURL, nil
+}
+
+// locateByDID resolves the DID document of the partner, which is cached by the resolver according to its metadata.
+func (l *AuthorizationServerLocator) locateByDID(ctx context.Context, id string) (*url.URL, error) {
+	result, err := l.didResolver().ResolveDID(ctx, id)
+	if errors.Is(err, did.DeactivatedErr) {
+		return nil, fmt.Errorf("DID document of %s is deactivated", id)
+	}
+	if err != nil {
+		return nil, err
+	}
+	var services []Service
+	for _, service := range result.Document.Service {
+		services = append(services, Service{Id: service.ID.String(), Type: service.Type, ServiceEndpoint: service.ServiceEndpoint})
+	}
+	return serviceEndpointURL(id, services, l.serviceType(), l.EndpointKey, parseAbsoluteURL)
+}
+
+// parseAbsoluteURL parses an Authorization Server URL, which must be absolute.
+func parseAbsoluteURL(value string) (*url.URL, error) {
+	result, err := url.Parse(value)
+	if err != nil || !result.IsAbs() || result.Host == "" {
+		return nil, fmt.Errorf("invalid service endpoint URL: %s", value)
+	}
+	return result, nil
+}
+
+func (l *AuthorizationServerLocator) serviceType() string {
+	if l.ServiceType == "" {
+		return DefaultAuthorizationServerServiceType
+	}
+	return l.ServiceType
+}
+
+func (l *AuthorizationServerLocator) didResolver() *CachingResolver {
+	if l.Resolver != nil {
+		return l.Resolver
+	}
+	l.mux.Lock()
+	defer l.mux.Unlock()
+	if l.resolver == nil {
+		l.resolver = &CachingResolver{Client: &ClientWithResponses{ClientInterface: l.Client}, TTL: l.cacheTTL()}
+	}
+	return l.resolver
+}
+
+func (l *AuthorizationServerLocator) cacheTTL() time.Duration {
+	if l.CacheTTL <= 0 {
+		return DefaultLocatorCacheTTL
+	}
+	return l.CacheTTL
+}
@@ -0,0 +1,141 @@
+package vdr
+
+import (
+	"context"
+	"github.com/nuts-foundation/go-nuts-client/nuts"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+)
+
+func TestAuthorizationServerLocator_Locate(t *testing.T) {
+	services := map[string]string{
+		"did:web:string":      `"https://string.example.com/oauth2"`,
+		"did:web:http":        `"http://http.example.com/oauth2"`,
+		"did:web:relative":    `"/oauth2"`,
+		"did:web:array":       `["urn:not-a-url", "https://array.example.com/oauth2"]`,
+		"did:web:object":      `{"authorization_server": "https://object.example.com/oauth2", "weight": 1}`,
+		"did:web:deactivated": `"https://deactivated.example.com/oauth2"`,
+	}
+	var resolutions atomic.Int32
+	handler := http.NewServeMux()
+	handler.HandleFunc("GET /internal/vdr/v2/did/{did}", func(w http.ResponseWriter, r *http.Request) {
+		resolutions.Add(1)
+		did := r.PathValue("did")
+		endpoint, ok := services[did]
+		if !ok {
+			w.Header().Set("Content-Type", "application/problem+json")
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write([]byte(`{"title": "unable to find the DID document", "status": 404}`))
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte(`{
+  "document": {
+    "@context": "https://www.w3.org/ns/did/v1",
+    "id": "` + did + `",
+    "service": [{"id": "` + did + `#oauth", "type": "oauth-authorization-server", "serviceEndpoint": ` + endpoint + `}]
+  },
+  "documentMetadata": {"created": "2024-01-01T00:00:00Z", "hash": "abc", "deactivated": ` + map[bool]string{true: "true", false: "false"}[did == "did:web:deactivated"] + `}
+}`))
+	})
+	handler.HandleFunc("GET /internal/vdr/v2/subject/{id}/service", func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "oauth-authorization-server", r.URL.Query().Get("type"))
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte(`[
+  {"id": "did:web:local#oauth", "type": "oauth-authorization-server", "serviceEndpoint": "https://local.example.com/oauth2"},
+  {"id": "did:nuts:local#oauth", "type": "oauth-authorization-server", "serviceEndpoint": "https://local.example.com/oauth2"}
+]`))
+	})
+	httpServer := httptest.NewServer(handler)
+	client, _ := NewClient(httpServer.URL)
+	responseTo := func(ctx context.Context) *http.Response {
+		return &http.Response{Request: httptest.NewRequest(http.MethodGet, "https://resource.example.com/fhir", nil).WithContext(ctx)}
+	}
+
+	t.Run("service endpoint shapes", func(t *testing.T) {
+		locator := &AuthorizationServerLocator{Client: client, EndpointKey: "authorization_server"}
+		for did, expected := range map[string]string{
+			"did:web:string": "https://string.example.com/oauth2",
+			"did:web:array":  "https://array.example.com/oauth2",
+			"did:web:object": "https://object.example.com/oauth2",
+			"did:web:http":   "http://http.example.com/oauth2",
+		} {
+			authServerURL, err := locator.Locate(nil, responseTo(nuts.WithPartnerDID(context.Background(), did)))
+
+			require.NoError(t, err)
+			require.Equal(t, expected, authServerURL.String())
+		}
+	})
+	t.Run("cached", func(t *testing.T) {
+		locator := &AuthorizationServerLocator{Client: client}
+		resolutions.Store(0)
+		ctx := nuts.WithPartnerDID(context.Background(), "did:web:deactivated")
+
+		_, err := locator.Locate(nil, responseTo(ctx))
+		require.EqualError(t, err, "DID document of did:web:deactivated is deactivated")
+		_, err = locator.Locate(nil, responseTo(ctx))
+
+		require.EqualError(t, err, "DID document of did:web:deactivated is deactivated")
+		require.Equal(t, int32(1), resolutions.Load())
+	})
+	t.Run("shared resolver", func(t *testing.T) {
+		resolver := &CachingResolver{Client: &ClientWithResponses{ClientInterface: client}}
+		resolutions.Store(0)
+		ctx := nuts.WithPartnerDID(context.Background(), "did:web:string")
+
+		for i := 0; i < 2; i++ {
+			locator := &AuthorizationServerLocator{Client: client, Resolver: resolver}
+			authServerURL, err := locator.Locate(nil, responseTo(ctx))
+			require.NoError(t, err)
+			require.Equal(t, "https://string.example.com/oauth2", authServerURL.String())
+		}
+
+		require.Equal(t, int32(1), resolutions.Load())
+	})
+	t.Run("local subject", func(t *testing.T) {
+		locator := &AuthorizationServerLocator{Client: client}
+
+		authServerURL, err := locator.Locate(nil, responseTo(nuts.WithPartnerSubject(context.Background(), "local")))
+
+		require.NoError(t, err)
+		require.Equal(t, "https://local.example.com/oauth2", authServerURL.String())
+	})
+	t.Run("no partner in context", func(t *testing.T) {
+		locator := &AuthorizationServerLocator{Client: client}
+
+		authServerURL, err := locator.Locate(nil, responseTo(context.Background()))
+
+		require.NoError(t, err)
+		require.Nil(t, authServerURL)
+	})
+	t.Run("no such service", func(t *testing.T) {
+		locator := &AuthorizationServerLocator{Client: client, ServiceType: "other"}
+
+		_, err := locator.Locate(nil, responseTo(nuts.WithPartnerDID(context.Background(), "did:web:string")))
+
+		require.EqualError(t, err, "did:web:string has no other service")
+	})
+	t.Run("relative URL", func(t *testing.T) {
+		locator := &AuthorizationServerLocator{Client: client}
+
+		_, err := locator.Locate(nil, responseTo(nuts.WithPartnerDID(context.Background(), "did:web:relative")))
+
+		require.EqualError(t, err, "service did:web:relative#oauth: invalid service endpoint URL: /oauth2")
+	})
+	t.Run("DID not found", func(t *testing.T) {
+		locator := &AuthorizationServerLocator{Client: client}
+		resolutions.Store(0)
+		ctx := nuts.WithPartnerDID(context.Background(), "did:web:unknown")
+
+		_, err := locator.Locate(nil, responseTo(ctx))
+		require.ErrorContains(t, err, "resolve DID did:web:unknown")
+		_, _ = locator.Locate(nil, responseTo(ctx))
+
+		require.Equal(t, int32(2), resolutions.Load())
+	})
+}
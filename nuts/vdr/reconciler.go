@@ -0,0 +1,254 @@
+package vdr
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/nuts-foundation/go-nuts-client/nuts"
+	"net/url"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// DesiredServices maps subject IDs to the DID services they must have. A subject can have one service per type.
+// Other services of the listed subjects are deleted, subjects that aren't listed are left alone.
+type DesiredServices map[string][]ServiceRequest
+
+// ServiceAction is the action the reconciler takes to bring a subject's DID service in the desired state.
+type ServiceAction string
+
+const (
+	// ServiceActionCreate creates the service for the subject.
+	ServiceActionCreate ServiceAction = "create"
+	// ServiceActionUpdate updates the endpoint of the subject's service.
+	ServiceActionUpdate ServiceAction = "update"
+	// ServiceActionDelete deletes the service from the subject.
+	ServiceActionDelete ServiceAction = "delete"
+)
+
+// ServiceChange is a change the reconciler made (or would make, in dry-run mode).
+type ServiceChange struct {
+	SubjectID   string
+	ServiceType string
+	// ServiceID is the ID (fragment) of the service that is updated or deleted.
+	ServiceID string
+	Action    ServiceAction
+	// Endpoint is the desired service endpoint, if the service is created or updated.
+	Endpoint interface{}
+	// Reason describes why the change is needed.
+	Reason string
+	// Err contains the error that occurred while making the change.
+	Err error
+}
+
+// ServiceReconcileReport describes the result of reconciling the DID services.
+type ServiceReconcileReport struct {
+	// DryRun indicates the changes weren't made.
+	DryRun bool
+	// Changes contains the (needed) changes, ordered by subject, service type and service ID.
+	Changes []ServiceChange
+	// Unchanged is the number of services that were already in the desired state.
+	Unchanged int
+}
+
+// ServiceReconciler brings the DID services of subjects in the desired state.
+// Reconciling is idempotent: services already in the desired state aren't touched.
+type ServiceReconciler struct {
+	// Client is the client of the VDR API of the Nuts node.
+	Client ClientInterface
+	// DryRun makes the reconciler only report the changes, without making them.
+	DryRun bool
+}
+
+// Reconcile compares the desired services with the current services (matched on type) and (unless in dry-run mode)
+// creates, updates or deletes services as needed. Endpoints are compared semantically: a single-element array equals its element,
+// and the scheme and host of URLs are case-insensitive (see EndpointsEqual).
+// Failed changes are reported and don't stop the reconciliation; the returned error joins their errors.
+func (r ServiceReconciler) Reconcile(ctx context.Context, desired DesiredServices) (*ServiceReconcileReport, error) {
+	subjectIDs := make([]string, 0, len(desired))
+	for subjectID, services := range desired {
+		types := make(map[string]bool)
+		for _, service := range services {
+			if types[service.Type] {
+				return nil, fmt.Errorf("subject %s has multiple desired services of type %s", subjectID, service.Type)
+			}
+			types[service.Type] = true
+		}
+		subjectIDs = append(subjectIDs, subjectID)
+	}
+	sort.Strings(subjectIDs)
+	report := ServiceReconcileReport{DryRun: r.DryRun}
+	var errs []error
+	for _, subjectID := range subjectIDs {
+		changes, unchanged, err := r.plan(ctx, subjectID, desired[subjectID])
+		if err != nil {
+			errs = append(errs, err)
+			report.Changes = append(report.Changes, ServiceChange{SubjectID: subjectID, Err: err})
+			continue
+		}
+		report.Unchanged += unchanged
+		for _, change := range changes {
+			if !r.DryRun {
+				r.apply(ctx, &change)
+				if change.Err != nil {
+					errs = append(errs, change.Err)
+				}
+			}
+			report.Changes = append(report.Changes, change)
+		}
+	}
+	return &report, errors.Join(errs...)
+}
+
+// plan returns the changes needed to bring the services of the subject in the desired state,
+// and the number of services that are already in the desired state.
+func (r ServiceReconciler) plan(ctx context.Context, subjectID string, desired []ServiceRequest) ([]ServiceChange, int, error) {
+	httpResponse, err := r.Client.FindServices(ctx, subjectID, &FindServicesParams{})
+	response, err := nuts.ParseResponse(err, httpResponse, ParseFindServicesResponse)
+	if err != nil {
+		return nil, 0, fmt.Errorf("find services of subject %s: %w", subjectID, err)
+	}
+	if response.JSON200 == nil {
+		return nil, 0, fmt.Errorf("failed find services of subject %s response: %s", subjectID, response.Status())
+	}
+	// A subject's service is present in the DID documents of all its DIDs, with the same fragment.
+	current := make(map[string][]Service)
+	var currentIDs []string
+	for _, service := range *response.JSON200 {
+		id := serviceFragment(service.Id)
+		if current[id] == nil {
+			currentIDs = append(currentIDs, id)
+		}
+		current[id] = append(current[id], service)
+	}
+	sort.Strings(currentIDs)
+	var changes []ServiceChange
+	unchanged := 0
+	matched := make(map[string]bool)
+	for _, service := range desired {
+		change := ServiceChange{SubjectID: subjectID, ServiceType: service.Type, Endpoint: service.ServiceEndpoint}
+		for _, id := range currentIDs {
+			if matched[id] || current[id][0].Type != service.Type {
+				continue
+			}
+			matched[id] = true
+			change.ServiceID = id
+			for _, instance := range current[id] {
+				if !EndpointsEqual(instance.ServiceEndpoint, service.ServiceEndpoint) {
+					change.Action = ServiceActionUpdate
+					change.Reason = "service endpoint differs"
+				}
+			}
+			break
+		}
+		switch {
+		case change.ServiceID == "":
+			change.Action = ServiceActionCreate
+			change.Reason = "service does not exist"
+			changes = append(changes, change)
+		case change.Action == "":
+			unchanged++
+		default:
+			changes = append(changes, change)
+		}
+	}
+	for _, id := range currentIDs {
+		if !matched[id] {
+			changes = append(changes, ServiceChange{
+				SubjectID:   subjectID,
+				ServiceType: current[id][0].Type,
+				ServiceID:   id,
+				Action:      ServiceActionDelete,
+				Reason:      "service is not desired",
+			})
+		}
+	}
+	sort.SliceStable(changes, func(i, j int) bool {
+		if changes[i].ServiceType != changes[j].ServiceType {
+			return changes[i].ServiceType < changes[j].ServiceType
+		}
+		return changes[i].ServiceID < changes[j].ServiceID
+	})
+	return changes, unchanged, nil
+}
+
+func (r ServiceReconciler) apply(ctx context.Context, change *ServiceChange) {
+	body := ServiceRequest{Type: change.ServiceType, ServiceEndpoint: change.Endpoint}
+	switch change.Action {
+	case ServiceActionCreate:
+		httpResponse, err := r.Client.CreateService(ctx, change.SubjectID, body)
+		_, err = nuts.ParseResponse(err, httpResponse, ParseCreateServiceResponse)
+		if err != nil {
+			change.Err = fmt.Errorf("create %s service for %s: %w", change.ServiceType, change.SubjectID, err)
+		}
+	case ServiceActionUpdate:
+		httpResponse, err := r.Client.UpdateService(ctx, change.SubjectID, change.ServiceID, body)
+		_, err = nuts.ParseResponse(err, httpResponse, ParseUpdateServiceResponse)
+		if err != nil {
+			change.Err = fmt.Errorf("update service %s of %s: %w", change.ServiceID, change.SubjectID, err)
+		}
+	case ServiceActionDelete:
+		httpResponse, err := r.Client.DeleteService(ctx, change.SubjectID, change.ServiceID)
+		_, err = nuts.ParseOptionalJSONResponse(err, httpResponse, ParseDeleteServiceResponse)
+		if err != nil {
+			change.Err = fmt.Errorf("delete service %s of %s: %w", change.ServiceID, change.SubjectID, err)
+		}
+	}
+}
+
+// serviceFragment returns the fragment of the service ID (e.g. fhir for did:web:example.com#fhir), or the ID if it has none.
+func serviceFragment(serviceID string) string {
+	if idx := strings.LastIndex(serviceID, "#"); idx != -1 {
+		return serviceID[idx+1:]
+	}
+	return serviceID
+}
+
+// EndpointsEqual reports whether the service endpoints are semantically equal:
+// equal in their JSON form, where a single-element array equals its element,
+// and URLs are equal regardless of the case of their scheme and host, and a trailing slash.
+func EndpointsEqual(a interface{}, b interface{}) bool {
+	var normalized [2]interface{}
+	for i, value := range []interface{}{a, b} {
+		data, err := json.Marshal(value)
+		if err != nil || json.Unmarshal(data, &normalized[i]) != nil {
+			return false
+		}
+		normalized[i] = normalizeEndpoint(normalized[i])
+	}
+	return reflect.DeepEqual(normalized[0], normalized[1])
+}
+
+func normalizeEndpoint(endpoint interface{}) interface{} {
+	switch value := endpoint.(type) {
+	case string:
+		u, err := url.Parse(value)
+		if err != nil || !u.IsAbs() || u.Host == "" {
+			return value
+		}
+		u.Scheme = strings.ToLower(u.Scheme)
+		u.Host = strings.ToLower(u.Host)
+		u.Path = strings.TrimSuffix(u.Path, "/")
+		u.RawPath = ""
+		return u.String()
+	case []interface{}:
+		if len(value) == 1 {
+			return normalizeEndpoint(value[0])
+		}
+		result := make([]interface{}, len(value))
+		for i, item := range value {
+			result[i] = normalizeEndpoint(item)
+		}
+		return result
+	case map[string]interface{}:
+		result := make(map[string]interface{}, len(value))
+		for key, item := range value {
+			result[key] = normalizeEndpoint(item)
+		}
+		return result
+	default:
+		return value
+	}
+}
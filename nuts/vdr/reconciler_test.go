@@ -0,0 +1,118 @@
+package vdr
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+func TestServiceReconciler_Reconcile(t *testing.T) {
+	var mux sync.Mutex
+	var calls []string
+	handler := http.NewServeMux()
+	handler.HandleFunc("GET /internal/vdr/v2/subject/{id}/service", func(w http.ResponseWriter, r *http.Request) {
+		if r.PathValue("id") == "broken" {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		if r.PathValue("id") == "b" {
+			_, _ = w.Write([]byte(`[]`))
+			return
+		}
+		_, _ = w.Write([]byte(`[
+  {"id": "did:web:a#fhir", "type": "fhir", "serviceEndpoint": "HTTPS://Example.com/fhir/"},
+  {"id": "did:nuts:a#fhir", "type": "fhir", "serviceEndpoint": ["https://example.com/fhir"]},
+  {"id": "did:web:a#notification", "type": "notification", "serviceEndpoint": {"url": "https://example.com/notify", "weight": 1}},
+  {"id": "did:web:a#oauth", "type": "oauth", "serviceEndpoint": "https://example.com/oauth2"}
+]`))
+	})
+	handler.HandleFunc("POST /internal/vdr/v2/subject/{id}/service", func(w http.ResponseWriter, r *http.Request) {
+		var body ServiceRequest
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		mux.Lock()
+		calls = append(calls, "create "+r.PathValue("id")+" "+body.Type)
+		mux.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte(`[]`))
+	})
+	handler.HandleFunc("POST /internal/vdr/v2/subject/{id}/service/{serviceId}", func(w http.ResponseWriter, r *http.Request) {
+		var body ServiceRequest
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		require.Equal(t, map[string]interface{}{"url": "https://example.com/notify", "weight": float64(2)}, body.ServiceEndpoint)
+		mux.Lock()
+		calls = append(calls, "update "+r.PathValue("id")+" "+r.PathValue("serviceId"))
+		mux.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte(`[]`))
+	})
+	handler.HandleFunc("DELETE /internal/vdr/v2/subject/{id}/service/{serviceId}", func(w http.ResponseWriter, r *http.Request) {
+		mux.Lock()
+		calls = append(calls, "delete "+r.PathValue("id")+" "+r.PathValue("serviceId"))
+		mux.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+	})
+	httpServer := httptest.NewServer(handler)
+	client, _ := NewClient(httpServer.URL)
+	desired := DesiredServices{
+		"a": {
+			{Type: "fhir", ServiceEndpoint: "https://example.com/fhir"},
+			{Type: "notification", ServiceEndpoint: map[string]interface{}{"url": "https://example.com/notify", "weight": 2}},
+		},
+		"b": {
+			{Type: "fhir", ServiceEndpoint: "https://b.example.com/fhir"},
+		},
+	}
+	expectedChanges := []ServiceChange{
+		{SubjectID: "a", ServiceType: "notification", ServiceID: "notification", Action: ServiceActionUpdate, Endpoint: desired["a"][1].ServiceEndpoint, Reason: "service endpoint differs"},
+		{SubjectID: "a", ServiceType: "oauth", ServiceID: "oauth", Action: ServiceActionDelete, Reason: "service is not desired"},
+		{SubjectID: "b", ServiceType: "fhir", Action: ServiceActionCreate, Endpoint: "https://b.example.com/fhir", Reason: "service does not exist"},
+	}
+
+	t.Run("dry-run", func(t *testing.T) {
+		calls = nil
+
+		report, err := ServiceReconciler{Client: client, DryRun: true}.Reconcile(context.Background(), desired)
+
+		require.NoError(t, err)
+		require.True(t, report.DryRun)
+		require.Equal(t, expectedChanges, report.Changes)
+		require.Equal(t, 1, report.Unchanged)
+		require.Empty(t, calls)
+	})
+	t.Run("apply", func(t *testing.T) {
+		calls = nil
+
+		report, err := ServiceReconciler{Client: client}.Reconcile(context.Background(), desired)
+
+		require.NoError(t, err)
+		require.Equal(t, expectedChanges, report.Changes)
+		require.Equal(t, []string{"update a notification", "delete a oauth", "create b fhir"}, calls)
+	})
+	t.Run("multiple services of the same type", func(t *testing.T) {
+		_, err := ServiceReconciler{Client: client}.Reconcile(context.Background(), DesiredServices{"a": {{Type: "fhir"}, {Type: "fhir"}}})
+
+		require.EqualError(t, err, "subject a has multiple desired services of type fhir")
+	})
+	t.Run("failure is reported", func(t *testing.T) {
+		report, err := ServiceReconciler{Client: client, DryRun: true}.Reconcile(context.Background(), DesiredServices{"broken": nil, "b": nil})
+
+		require.ErrorContains(t, err, "find services of subject broken")
+		require.Len(t, report.Changes, 1)
+		require.Equal(t, "broken", report.Changes[0].SubjectID)
+	})
+}
+
+func TestEndpointsEqual(t *testing.T) {
+	require.True(t, EndpointsEqual("https://example.com/fhir", []string{"HTTPS://EXAMPLE.com/fhir/"}))
+	require.True(t, EndpointsEqual(map[string]interface{}{"weight": 1}, map[string]interface{}{"weight": 1.0}))
+	require.False(t, EndpointsEqual("https://example.com/FHIR", "https://example.com/fhir"))
+	require.False(t, EndpointsEqual([]string{"https://a.example.com", "https://b.example.com"}, []string{"https://b.example.com", "https://a.example.com"}))
+}
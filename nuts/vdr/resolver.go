@@ -0,0 +1,200 @@
+package vdr
+
+import (
+	"container/list"
+	"context"
+	"fmt"
+	"github.com/nuts-foundation/go-did/did"
+	"github.com/nuts-foundation/go-nuts-client/internal/singleflight"
+	"github.com/nuts-foundation/go-nuts-client/nuts"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// DefaultResolverCacheTTL is the duration a CachingResolver caches DID documents if CachingResolver.TTL is not set.
+const DefaultResolverCacheTTL = 5 * time.Minute
+
+// DefaultResolverCacheMaxEntries is the maximum number of DID documents a CachingResolver caches if CachingResolver.MaxEntries is not set.
+const DefaultResolverCacheMaxEntries = 10000
+
+// DefaultResolverCacheTimeout is the maximum duration of a DID resolution if CachingResolver.Timeout is not set.
+const DefaultResolverCacheTimeout = 10 * time.Second
+
+// CachingResolver resolves DID documents through the Nuts node, caching the results:
+//   - a resolved DID document is cached for the TTL, or shorter if it was updated recently (less than the TTL ago),
+//     since it is then likely to change again (e.g. during key rotation): it is cached for the time since its update (but at least a tenth of the TTL).
+//   - a deactivated DID document is cached until it is evicted, since deactivation is permanent.
+//   - failed resolutions (e.g. unknown DIDs) aren't cached.
+//
+// When the cache is full, the least recently used DID document is evicted.
+// Concurrent resolutions of the same DID result in a single request to the Nuts node,
+// which isn't cancelled when the first caller is, but is bounded by Timeout.
+// It also implements did.Resolver. It must not be copied after first use.
+type CachingResolver struct {
+	// Client is the client of the VDR API of the Nuts node.
+	Client ClientWithResponsesInterface
+	// TTL is the maximum duration DID documents are cached. If not set, DefaultResolverCacheTTL is used.
+	TTL time.Duration
+	// MaxEntries is the maximum number of cached DID documents. If not set, DefaultResolverCacheMaxEntries is used.
+	MaxEntries int
+	// Timeout is the maximum duration of a DID resolution. If not set, DefaultResolverCacheTimeout is used.
+	Timeout time.Duration
+	// OnChange is optionally called when a refreshed DID document differs (in version hash) from the cached one.
+	OnChange func(did string, previous *DIDResolutionResult, current *DIDResolutionResult)
+
+	mux      sync.Mutex
+	entries  map[string]*list.Element
+	lru      *list.List
+	inflight singleflight.Group[string, *DIDResolutionResult]
+}
+
+var _ did.Resolver = &CachingResolver{}
+
+type resolverCacheEntry struct {
+	did    string
+	result *DIDResolutionResult
+	// expiresAt is the time the entry must be refreshed, or the zero time if it never expires.
+	expiresAt time.Time
+}
+
+// ResolveDID returns the DID document and its metadata, from cache if possible.
+// It returns did.NotFoundErr if the DID document doesn't exist, and did.DeactivatedErr (with the result) if it is deactivated.
+func (r *CachingResolver) ResolveDID(ctx context.Context, id string) (*DIDResolutionResult, error) {
+	r.mux.Lock()
+	r.init()
+	var previous *DIDResolutionResult
+	if element, ok := r.entries[id]; ok {
+		entry := element.Value.(*resolverCacheEntry)
+		if entry.expiresAt.IsZero() || time.Now().Before(entry.expiresAt) {
+			r.lru.MoveToFront(element)
+			r.mux.Unlock()
+			return entry.result, resolutionError(entry.result)
+		}
+		previous = entry.result
+	}
+	r.mux.Unlock()
+	timeout := r.Timeout
+	if timeout <= 0 {
+		timeout = DefaultResolverCacheTimeout
+	}
+	result, err := r.inflight.Do(ctx, id, timeout, func(ctx context.Context) (*DIDResolutionResult, error) {
+		return r.resolveAndCache(ctx, id, previous)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, resolutionError(result)
+}
+
+// Resolve implements did.Resolver.
+func (r *CachingResolver) Resolve(inputDID string) (*did.Document, *did.DocumentMetadata, error) {
+	result, err := r.ResolveDID(context.Background(), inputDID)
+	if result == nil {
+		return nil, nil, err
+	}
+	metadata := did.DocumentMetadata{
+		Properties: map[string]interface{}{
+			"hash":        result.DocumentMetadata.Hash,
+			"deactivated": result.DocumentMetadata.Deactivated,
+		},
+	}
+	if created, err := time.Parse(time.RFC3339, result.DocumentMetadata.Created); err == nil {
+		metadata.Created = &created
+	}
+	if updated := result.DocumentMetadata.Updated; updated != nil {
+		if updated, err := time.Parse(time.RFC3339, *updated); err == nil {
+			metadata.Updated = &updated
+		}
+	}
+	return &result.Document, &metadata, err
+}
+
+// Invalidate removes the DID document from the cache, so it is resolved again on next use.
+func (r *CachingResolver) Invalidate(id string) {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	r.init()
+	if element, ok := r.entries[id]; ok {
+		r.remove(element)
+	}
+}
+
+// resolveAndCache resolves the DID document and caches the result. If it differs from the previous result, OnChange is called.
+func (r *CachingResolver) resolveAndCache(ctx context.Context, id string, previous *DIDResolutionResult) (*DIDResolutionResult, error) {
+	result, err := r.resolve(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	r.mux.Lock()
+	r.add(&resolverCacheEntry{did: id, result: result, expiresAt: r.expiry(result)})
+	r.mux.Unlock()
+	if previous != nil && r.OnChange != nil && previous.DocumentMetadata.Hash != result.DocumentMetadata.Hash {
+		r.OnChange(id, previous, result)
+	}
+	return result, nil
+}
+
+func (r *CachingResolver) add(entry *resolverCacheEntry) {
+	if element, ok := r.entries[entry.did]; ok {
+		r.remove(element)
+	}
+	maxEntries := r.MaxEntries
+	if maxEntries <= 0 {
+		maxEntries = DefaultResolverCacheMaxEntries
+	}
+	for r.lru.Len() >= maxEntries {
+		r.remove(r.lru.Back())
+	}
+	r.entries[entry.did] = r.lru.PushFront(entry)
+}
+
+func (r *CachingResolver) remove(element *list.Element) {
+	r.lru.Remove(element)
+	delete(r.entries, element.Value.(*resolverCacheEntry).did)
+}
+
+func (r *CachingResolver) init() {
+	if r.entries == nil {
+		r.entries = make(map[string]*list.Element)
+		r.lru = list.New()
+	}
+}
+
+func (r *CachingResolver) resolve(ctx context.Context, id string) (*DIDResolutionResult, error) {
+	response, err := r.Client.ResolveDIDWithResponse(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("resolve DID %s: http request failed: %w", id, nuts.UnwrapAPIError(err))
+	}
+	if response.StatusCode() == http.StatusNotFound {
+		return nil, fmt.Errorf("resolve DID %s: %w", id, did.NotFoundErr)
+	}
+	if response.JSON200 == nil {
+		return nil, fmt.Errorf("failed resolve DID %s response: %s", id, response.Status())
+	}
+	return response.JSON200, nil
+}
+
+// expiry returns the time the resolution result must be refreshed, or the zero time if it never needs to be refreshed.
+func (r *CachingResolver) expiry(result *DIDResolutionResult) time.Time {
+	if result.DocumentMetadata.Deactivated {
+		return time.Time{}
+	}
+	ttl := r.TTL
+	if ttl <= 0 {
+		ttl = DefaultResolverCacheTTL
+	}
+	if result.DocumentMetadata.Updated != nil {
+		if updated, err := time.Parse(time.RFC3339, *result.DocumentMetadata.Updated); err == nil {
+			ttl = min(ttl, max(time.Since(updated), ttl/10))
+		}
+	}
+	return time.Now().Add(ttl)
+}
+
+func resolutionError(result *DIDResolutionResult) error {
+	if result.DocumentMetadata.Deactivated {
+		return did.DeactivatedErr
+	}
+	return nil
+}
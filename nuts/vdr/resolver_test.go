@@ -0,0 +1,218 @@
+package vdr
+
+import (
+	"context"
+	"github.com/nuts-foundation/go-did/did"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestCachingResolver_ResolveDID(t *testing.T) {
+	var resolutions atomic.Int32
+	var hash atomic.Value
+	hash.Store("v1")
+	release := make(chan struct{})
+	close(release)
+	var releaseMux sync.Mutex
+	handler := http.NewServeMux()
+	handler.HandleFunc("GET /internal/vdr/v2/did/{did}", func(w http.ResponseWriter, r *http.Request) {
+		resolutions.Add(1)
+		releaseMux.Lock()
+		wait := release
+		releaseMux.Unlock()
+		<-wait
+		id := r.PathValue("did")
+		metadata := `{"created": "2024-01-01T00:00:00Z", "hash": "` + hash.Load().(string) + `", "deactivated": false}`
+		switch id {
+		case "did:web:unknown":
+			w.Header().Set("Content-Type", "application/problem+json")
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write([]byte(`{"title": "unable to find the DID document", "status": 404}`))
+			return
+		case "did:web:deactivated":
+			metadata = `{"created": "2024-01-01T00:00:00Z", "hash": "v1", "deactivated": true}`
+		case "did:web:updated":
+			metadata = `{"created": "2024-01-01T00:00:00Z", "updated": "` + time.Now().Format(time.RFC3339) + `", "hash": "v1", "deactivated": false}`
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte(`{"document": {"@context": "https://www.w3.org/ns/did/v1", "id": "` + id + `"}, "documentMetadata": ` + metadata + `}`))
+	})
+	httpServer := httptest.NewServer(handler)
+	client, _ := NewClientWithResponses(httpServer.URL)
+
+	t.Run("cached", func(t *testing.T) {
+		resolver := &CachingResolver{Client: client}
+		resolutions.Store(0)
+
+		for i := 0; i < 3; i++ {
+			result, err := resolver.ResolveDID(context.Background(), "did:web:example.com")
+			require.NoError(t, err)
+			require.Equal(t, "did:web:example.com", result.Document.ID.String())
+		}
+
+		require.Equal(t, int32(1), resolutions.Load())
+		t.Run("invalidate", func(t *testing.T) {
+			resolver.Invalidate("did:web:example.com")
+
+			_, err := resolver.ResolveDID(context.Background(), "did:web:example.com")
+
+			require.NoError(t, err)
+			require.Equal(t, int32(2), resolutions.Load())
+		})
+	})
+	t.Run("refreshed after TTL", func(t *testing.T) {
+		var changes []string
+		resolver := &CachingResolver{Client: client, TTL: time.Millisecond, OnChange: func(did string, previous *DIDResolutionResult, current *DIDResolutionResult) {
+			changes = append(changes, did+" "+previous.DocumentMetadata.Hash+" "+current.DocumentMetadata.Hash)
+		}}
+		resolutions.Store(0)
+		defer hash.Store("v1")
+		_, _ = resolver.ResolveDID(context.Background(), "did:web:example.com")
+		time.Sleep(2 * time.Millisecond)
+		_, _ = resolver.ResolveDID(context.Background(), "did:web:example.com")
+		hash.Store("v2")
+		time.Sleep(2 * time.Millisecond)
+
+		result, err := resolver.ResolveDID(context.Background(), "did:web:example.com")
+
+		require.NoError(t, err)
+		require.Equal(t, "v2", result.DocumentMetadata.Hash)
+		require.Equal(t, int32(3), resolutions.Load())
+		require.Equal(t, []string{"did:web:example.com v1 v2"}, changes)
+	})
+	t.Run("recently updated document is cached shorter", func(t *testing.T) {
+		resolver := &CachingResolver{Client: client, TTL: time.Hour}
+
+		_, err := resolver.ResolveDID(context.Background(), "did:web:updated")
+
+		require.NoError(t, err)
+		require.Less(t, time.Until(resolver.entries["did:web:updated"].Value.(*resolverCacheEntry).expiresAt), 10*time.Minute)
+	})
+	t.Run("deactivated document is cached", func(t *testing.T) {
+		resolver := &CachingResolver{Client: client, TTL: time.Millisecond}
+		resolutions.Store(0)
+
+		result, err := resolver.ResolveDID(context.Background(), "did:web:deactivated")
+		require.ErrorIs(t, err, did.DeactivatedErr)
+		require.True(t, result.DocumentMetadata.Deactivated)
+		time.Sleep(2 * time.Millisecond)
+		_, err = resolver.ResolveDID(context.Background(), "did:web:deactivated")
+
+		require.ErrorIs(t, err, did.DeactivatedErr)
+		require.Equal(t, int32(1), resolutions.Load())
+	})
+	t.Run("not found is not cached", func(t *testing.T) {
+		resolver := &CachingResolver{Client: client}
+		resolutions.Store(0)
+
+		_, err := resolver.ResolveDID(context.Background(), "did:web:unknown")
+		require.ErrorIs(t, err, did.NotFoundErr)
+		_, err = resolver.ResolveDID(context.Background(), "did:web:unknown")
+
+		require.ErrorIs(t, err, did.NotFoundErr)
+		require.Equal(t, int32(2), resolutions.Load())
+	})
+	t.Run("concurrent resolutions are deduplicated", func(t *testing.T) {
+		resolver := &CachingResolver{Client: client}
+		resolutions.Store(0)
+		releaseMux.Lock()
+		release = make(chan struct{})
+		releaseMux.Unlock()
+		var wg sync.WaitGroup
+		errs := make(chan error, 10)
+		for i := 0; i < 10; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				_, err := resolver.ResolveDID(context.Background(), "did:web:concurrent")
+				errs <- err
+			}()
+		}
+		require.Eventually(t, func() bool { return resolutions.Load() == 1 }, time.Second, time.Millisecond)
+		time.Sleep(10 * time.Millisecond)
+		releaseMux.Lock()
+		close(release)
+		releaseMux.Unlock()
+		wg.Wait()
+		close(errs)
+
+		for err := range errs {
+			require.NoError(t, err)
+		}
+		require.Equal(t, int32(1), resolutions.Load())
+	})
+	t.Run("cancelled caller doesn't cancel waiting callers", func(t *testing.T) {
+		resolver := &CachingResolver{Client: client}
+		resolutions.Store(0)
+		releaseMux.Lock()
+		release = make(chan struct{})
+		releaseMux.Unlock()
+		ctx, cancel := context.WithCancel(context.Background())
+		firstErr := make(chan error, 1)
+		go func() {
+			_, err := resolver.ResolveDID(ctx, "did:web:cancelled")
+			firstErr <- err
+		}()
+		require.Eventually(t, func() bool { return resolutions.Load() == 1 }, time.Second, time.Millisecond)
+		secondErr := make(chan error, 1)
+		go func() {
+			_, err := resolver.ResolveDID(context.Background(), "did:web:cancelled")
+			secondErr <- err
+		}()
+		cancel()
+		require.ErrorIs(t, <-firstErr, context.Canceled)
+		releaseMux.Lock()
+		close(release)
+		releaseMux.Unlock()
+
+		require.NoError(t, <-secondErr)
+		require.Equal(t, int32(1), resolutions.Load())
+	})
+	t.Run("resolution times out", func(t *testing.T) {
+		resolver := &CachingResolver{Client: client, Timeout: 10 * time.Millisecond}
+		releaseMux.Lock()
+		release = make(chan struct{})
+		releaseMux.Unlock()
+		defer func() {
+			releaseMux.Lock()
+			close(release)
+			releaseMux.Unlock()
+		}()
+
+		_, err := resolver.ResolveDID(context.Background(), "did:web:slow")
+
+		require.ErrorIs(t, err, context.DeadlineExceeded)
+		require.Empty(t, resolver.entries)
+	})
+	t.Run("least recently used document is evicted", func(t *testing.T) {
+		resolver := &CachingResolver{Client: client, MaxEntries: 2}
+		resolutions.Store(0)
+		_, _ = resolver.ResolveDID(context.Background(), "did:web:a")
+		_, _ = resolver.ResolveDID(context.Background(), "did:web:deactivated")
+		_, _ = resolver.ResolveDID(context.Background(), "did:web:a")
+
+		_, _ = resolver.ResolveDID(context.Background(), "did:web:b")
+
+		require.Len(t, resolver.entries, 2)
+		require.Contains(t, resolver.entries, "did:web:a")
+		require.NotContains(t, resolver.entries, "did:web:deactivated")
+		require.Equal(t, int32(3), resolutions.Load())
+	})
+	t.Run("did.Resolver", func(t *testing.T) {
+		resolver := &CachingResolver{Client: client}
+
+		document, metadata, err := resolver.Resolve("did:web:updated")
+
+		require.NoError(t, err)
+		require.Equal(t, "did:web:updated", document.ID.String())
+		require.Equal(t, time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), metadata.Created.UTC())
+		require.NotNil(t, metadata.Updated)
+		require.Equal(t, "v1", metadata.Properties["hash"])
+	})
+}
@@ -0,0 +1,132 @@
+package vdr
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/nuts-foundation/go-did/did"
+	"github.com/nuts-foundation/go-nuts-client/nuts"
+	"time"
+)
+
+// KeyPurpose is the purpose of a verification method, which corresponds to the key types of KeyCreationOptions.
+type KeyPurpose string
+
+const (
+	// KeyPurposeAssertion is the purpose of assertion keys (see KeyCreationOptions.AssertionKey), e.g. to sign credentials and tokens.
+	KeyPurposeAssertion KeyPurpose = "assertion"
+	// KeyPurposeEncryption is the purpose of encryption keys (see KeyCreationOptions.EncryptionKey).
+	KeyPurposeEncryption KeyPurpose = "encryption"
+)
+
+// KeyRotationReport describes a key rotation of a subject, to be kept as audit trail.
+type KeyRotationReport struct {
+	SubjectID string `json:"subjectID"`
+	// RotatedAt is the time the new verification methods were added.
+	RotatedAt time.Time `json:"rotatedAt"`
+	// Options contains the key types that were rotated.
+	Options KeyCreationOptions `json:"options"`
+	// Added contains the verification methods that were added, for all DIDs of the subject.
+	Added []RotatedVerificationMethod `json:"added"`
+	// Retirable contains the verification methods that were replaced by the added verification methods.
+	// They can be retired once the credentials and access tokens they signed expired.
+	Retirable []RotatedVerificationMethod `json:"retirable"`
+}
+
+// RotatedVerificationMethod is a verification method that was added or replaced during key rotation.
+type RotatedVerificationMethod struct {
+	ID      string     `json:"id"`
+	DID     string     `json:"did"`
+	Purpose KeyPurpose `json:"purpose"`
+	// Confirmed indicates the (added) verification method is present in the resolved DID document.
+	Confirmed bool `json:"confirmed,omitempty"`
+}
+
+// RotateKeys adds new verification methods of the given key types to all DIDs of the subject,
+// and confirms they are present in the resolved DID documents.
+// The Nuts node then uses the new keys, but the replaced verification methods remain in the DID documents,
+// so credentials and access tokens they signed can still be verified. The report lists them, so they can be retired later.
+// If not all new verification methods are present in the resolved DID documents, the report is returned with an error.
+func RotateKeys(ctx context.Context, client ClientInterface, subjectID string, options KeyCreationOptions) (*KeyRotationReport, error) {
+	if !options.AssertionKey && !options.EncryptionKey {
+		return nil, errors.New("no key types to rotate")
+	}
+	dids, err := SubjectDIDs(ctx, client, subjectID)
+	if err != nil {
+		return nil, err
+	}
+	report := KeyRotationReport{SubjectID: subjectID, Options: options}
+	for _, id := range dids {
+		document, err := resolveDocument(ctx, client, id)
+		if err != nil {
+			return nil, err
+		}
+		for _, method := range document.VerificationMethod {
+			purpose, ok := keyPurpose(*document, method)
+			if ok && (purpose == KeyPurposeAssertion && options.AssertionKey || purpose == KeyPurposeEncryption && options.EncryptionKey) {
+				report.Retirable = append(report.Retirable, RotatedVerificationMethod{ID: method.ID.String(), DID: id, Purpose: purpose})
+			}
+		}
+	}
+
+	httpResponse, err := client.AddVerificationMethod(ctx, subjectID, options)
+	response, err := nuts.ParseResponse(err, httpResponse, ParseAddVerificationMethodResponse)
+	if err != nil {
+		return nil, fmt.Errorf("add verification methods: %w", err)
+	}
+	if response.JSON200 == nil {
+		return nil, fmt.Errorf("failed add verification methods response: %s", response.Status())
+	}
+	report.RotatedAt = time.Now()
+	for _, method := range *response.JSON200 {
+		report.Added = append(report.Added, RotatedVerificationMethod{ID: method.Id, DID: method.Controller})
+	}
+
+	documents := make(map[string]*did.Document)
+	var errs []error
+	for i, added := range report.Added {
+		if documents[added.DID] == nil {
+			if documents[added.DID], err = resolveDocument(ctx, client, added.DID); err != nil {
+				errs = append(errs, err)
+				continue
+			}
+		}
+		document := documents[added.DID]
+		methodID, err := did.ParseDIDURL(added.ID)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("invalid verification method ID: %w", err))
+			continue
+		}
+		if method := document.VerificationMethod.FindByID(*methodID); method != nil {
+			report.Added[i].Purpose, report.Added[i].Confirmed = keyPurpose(*document, method)
+		}
+		if !report.Added[i].Confirmed {
+			errs = append(errs, fmt.Errorf("verification method %s is not in the resolved DID document", added.ID))
+		}
+	}
+	return &report, errors.Join(errs...)
+}
+
+func resolveDocument(ctx context.Context, client ClientInterface, id string) (*did.Document, error) {
+	httpResponse, err := client.ResolveDID(ctx, id)
+	response, err := nuts.ParseResponse(err, httpResponse, ParseResolveDIDResponse)
+	if err != nil {
+		return nil, fmt.Errorf("resolve DID %s: %w", id, err)
+	}
+	if response.JSON200 == nil {
+		return nil, fmt.Errorf("failed resolve DID %s response: %s", id, response.Status())
+	}
+	return &response.JSON200.Document, nil
+}
+
+// keyPurpose returns the purpose of the verification method, derived from its verification relationships.
+func keyPurpose(document did.Document, method *did.VerificationMethod) (KeyPurpose, bool) {
+	switch {
+	case document.AssertionMethod.FindByID(method.ID) != nil:
+		return KeyPurposeAssertion, true
+	case document.KeyAgreement.FindByID(method.ID) != nil:
+		return KeyPurposeEncryption, true
+	default:
+		return "", false
+	}
+}
@@ -0,0 +1,112 @@
+package vdr
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+func TestRotateKeys(t *testing.T) {
+	var mux sync.Mutex
+	// methods contains the verification methods of the DIDs, by key purpose
+	methods := map[string]map[string][]string{
+		"did:web:example.com:iam:a": {"assertion": {"#key-1"}, "encryption": {"#enc-1"}},
+		"did:nuts:a":                {"assertion": {"#key-1"}},
+	}
+	lagging := false
+	handler := http.NewServeMux()
+	handler.HandleFunc("GET /internal/vdr/v2/subject/{id}", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte(`["did:nuts:a", "did:web:example.com:iam:a"]`))
+	})
+	handler.HandleFunc("GET /internal/vdr/v2/did/{did}", func(w http.ResponseWriter, r *http.Request) {
+		id := r.PathValue("did")
+		mux.Lock()
+		defer mux.Unlock()
+		document := map[string]interface{}{
+			"@context": "https://www.w3.org/ns/did/v1",
+			"id":       id,
+		}
+		var verificationMethods []interface{}
+		var assertionMethod, keyAgreement []string
+		for purpose, fragments := range methods[id] {
+			for _, fragment := range fragments {
+				verificationMethods = append(verificationMethods, map[string]interface{}{
+					"id":           id + fragment,
+					"type":         "JsonWebKey2020",
+					"controller":   id,
+					"publicKeyJwk": map[string]interface{}{"kty": "EC", "crv": "P-256", "x": "", "y": ""},
+				})
+				if purpose == "assertion" {
+					assertionMethod = append(assertionMethod, id+fragment)
+				} else {
+					keyAgreement = append(keyAgreement, id+fragment)
+				}
+			}
+		}
+		document["verificationMethod"] = verificationMethods
+		document["assertionMethod"] = assertionMethod
+		document["keyAgreement"] = keyAgreement
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"document": document, "documentMetadata": map[string]interface{}{}})
+	})
+	handler.HandleFunc("POST /internal/vdr/v2/subject/{id}/verificationmethod", func(w http.ResponseWriter, r *http.Request) {
+		var options KeyCreationOptions
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&options))
+		require.True(t, options.AssertionKey)
+		require.False(t, options.EncryptionKey)
+		mux.Lock()
+		defer mux.Unlock()
+		var added []VerificationMethod
+		for _, id := range []string{"did:nuts:a", "did:web:example.com:iam:a"} {
+			added = append(added, VerificationMethod{Id: id + "#key-2", Controller: id, Type: "JsonWebKey2020"})
+			if !lagging || id != "did:nuts:a" {
+				methods[id]["assertion"] = append(methods[id]["assertion"], "#key-2")
+			}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		_ = json.NewEncoder(w).Encode(added)
+	})
+	httpServer := httptest.NewServer(handler)
+	client, _ := NewClient(httpServer.URL)
+
+	t.Run("ok", func(t *testing.T) {
+		report, err := RotateKeys(context.Background(), client, "a", KeyCreationOptions{AssertionKey: true})
+
+		require.NoError(t, err)
+		require.Equal(t, "a", report.SubjectID)
+		require.False(t, report.RotatedAt.IsZero())
+		require.Equal(t, []RotatedVerificationMethod{
+			{ID: "did:nuts:a#key-2", DID: "did:nuts:a", Purpose: KeyPurposeAssertion, Confirmed: true},
+			{ID: "did:web:example.com:iam:a#key-2", DID: "did:web:example.com:iam:a", Purpose: KeyPurposeAssertion, Confirmed: true},
+		}, report.Added)
+		require.Equal(t, []RotatedVerificationMethod{
+			{ID: "did:nuts:a#key-1", DID: "did:nuts:a", Purpose: KeyPurposeAssertion},
+			{ID: "did:web:example.com:iam:a#key-1", DID: "did:web:example.com:iam:a", Purpose: KeyPurposeAssertion},
+		}, report.Retirable)
+	})
+	t.Run("not confirmed", func(t *testing.T) {
+		mux.Lock()
+		lagging = true
+		methods["did:nuts:a"]["assertion"] = []string{"#key-1"}
+		mux.Unlock()
+
+		report, err := RotateKeys(context.Background(), client, "a", KeyCreationOptions{AssertionKey: true})
+
+		require.EqualError(t, err, "verification method did:nuts:a#key-2 is not in the resolved DID document")
+		require.False(t, report.Added[0].Confirmed)
+		require.True(t, report.Added[1].Confirmed)
+	})
+	t.Run("no key types", func(t *testing.T) {
+		_, err := RotateKeys(context.Background(), client, "a", KeyCreationOptions{})
+
+		require.EqualError(t, err, "no key types to rotate")
+	})
+}
@@ -0,0 +1,82 @@
+package vdr
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/nuts-foundation/go-nuts-client/nuts"
+	"net/http"
+)
+
+// ErrSubjectNotFound is returned when a subject doesn't exist (or has been deactivated) on the Nuts node.
+var ErrSubjectNotFound = errors.New("subject not found")
+
+// Subject is a subject on the Nuts node, as returned by EnsureSubject.
+type Subject struct {
+	ID string
+	// DIDs contains the DIDs of the subject.
+	DIDs []string
+	// Created indicates whether the subject was created, or already existed.
+	Created bool
+}
+
+// SubjectDIDs returns the DIDs of the subject. If the subject doesn't exist, it returns an error that wraps ErrSubjectNotFound.
+func SubjectDIDs(ctx context.Context, client ClientInterface, subjectID string) ([]string, error) {
+	httpResponse, err := client.SubjectDIDs(ctx, subjectID)
+	if err == nil && httpResponse.StatusCode == http.StatusNotFound {
+		_ = httpResponse.Body.Close()
+		return nil, fmt.Errorf("%w: %s", ErrSubjectNotFound, subjectID)
+	}
+	response, err := nuts.ParseResponse(err, httpResponse, ParseSubjectDIDsResponse)
+	if err != nil {
+		return nil, fmt.Errorf("list subject DIDs: %w", err)
+	}
+	if response.JSON200 == nil {
+		return nil, fmt.Errorf("failed list subject DIDs response: %s", response.Status())
+	}
+	return *response.JSON200, nil
+}
+
+// EnsureSubject returns the subject with the given ID, creating it with the given options if it doesn't exist.
+// The subject in the options is ignored, and the key options only apply when the subject is created:
+// the keys of an existing subject aren't checked. This allows provisioning to be re-run safely.
+func EnsureSubject(ctx context.Context, client ClientInterface, subjectID string, options CreateSubjectOptions) (*Subject, error) {
+	dids, err := SubjectDIDs(ctx, client, subjectID)
+	if err == nil {
+		return &Subject{ID: subjectID, DIDs: dids}, nil
+	}
+	if !errors.Is(err, ErrSubjectNotFound) {
+		return nil, err
+	}
+	options.Subject = &subjectID
+	httpResponse, err := client.CreateSubject(ctx, options)
+	response, err := nuts.ParseResponse(err, httpResponse, ParseCreateSubjectResponse)
+	if err != nil {
+		return nil, fmt.Errorf("create subject: %w", err)
+	}
+	if response.JSON200 == nil {
+		return nil, fmt.Errorf("failed create subject response: %s", response.Status())
+	}
+	result := Subject{ID: response.JSON200.Subject, Created: true}
+	for _, document := range response.JSON200.Documents {
+		result.DIDs = append(result.DIDs, document.ID.String())
+	}
+	return &result, nil
+}
+
+// EnsureDeactivated deactivates the subject, unless it doesn't exist (or is already deactivated).
+// It reports whether the subject was deactivated.
+func EnsureDeactivated(ctx context.Context, client ClientInterface, subjectID string) (bool, error) {
+	httpResponse, err := client.Deactivate(ctx, subjectID)
+	if err == nil && httpResponse.StatusCode == http.StatusNotFound {
+		_ = httpResponse.Body.Close()
+		return false, nil
+	}
+	if err == nil && httpResponse.StatusCode >= 200 && httpResponse.StatusCode < 300 {
+		// Response has no content
+		_ = httpResponse.Body.Close()
+		return true, nil
+	}
+	_, err = nuts.ParseResponse(err, httpResponse, ParseDeactivateResponse)
+	return false, fmt.Errorf("deactivate subject: %w", err)
+}
@@ -0,0 +1,85 @@
+package vdr
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+func TestEnsureSubject(t *testing.T) {
+	var mux sync.Mutex
+	subjects := map[string][]string{"existing": {"did:web:example.com:iam:existing"}}
+	handler := http.NewServeMux()
+	handler.HandleFunc("GET /internal/vdr/v2/subject/{id}", func(w http.ResponseWriter, r *http.Request) {
+		mux.Lock()
+		dids, ok := subjects[r.PathValue("id")]
+		mux.Unlock()
+		if !ok {
+			w.Header().Set("Content-Type", "application/problem+json")
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write([]byte(`{"title": "subject not found", "status": 404}`))
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		_ = json.NewEncoder(w).Encode(dids)
+	})
+	handler.HandleFunc("POST /internal/vdr/v2/subject", func(w http.ResponseWriter, r *http.Request) {
+		var options CreateSubjectOptions
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&options))
+		require.True(t, options.Keys.EncryptionKey)
+		did := "did:web:example.com:iam:" + *options.Subject
+		mux.Lock()
+		subjects[*options.Subject] = []string{did}
+		mux.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte(`{"subject": "` + *options.Subject + `", "documents": [{"@context": "https://www.w3.org/ns/did/v1", "id": "` + did + `"}]}`))
+	})
+	handler.HandleFunc("DELETE /internal/vdr/v2/subject/{id}", func(w http.ResponseWriter, r *http.Request) {
+		mux.Lock()
+		defer mux.Unlock()
+		if _, ok := subjects[r.PathValue("id")]; !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		delete(subjects, r.PathValue("id"))
+		w.WriteHeader(http.StatusNoContent)
+	})
+	httpServer := httptest.NewServer(handler)
+	client, _ := NewClient(httpServer.URL)
+	options := CreateSubjectOptions{Keys: &KeyCreationOptions{AssertionKey: true, EncryptionKey: true}}
+
+	t.Run("existing subject", func(t *testing.T) {
+		subject, err := EnsureSubject(context.Background(), client, "existing", options)
+
+		require.NoError(t, err)
+		require.Equal(t, Subject{ID: "existing", DIDs: []string{"did:web:example.com:iam:existing"}}, *subject)
+	})
+	t.Run("new subject", func(t *testing.T) {
+		subject, err := EnsureSubject(context.Background(), client, "new", options)
+		require.NoError(t, err)
+		require.Equal(t, Subject{ID: "new", DIDs: []string{"did:web:example.com:iam:new"}, Created: true}, *subject)
+
+		subject, err = EnsureSubject(context.Background(), client, "new", options)
+
+		require.NoError(t, err)
+		require.False(t, subject.Created)
+	})
+	t.Run("deactivate", func(t *testing.T) {
+		deactivated, err := EnsureDeactivated(context.Background(), client, "existing")
+		require.NoError(t, err)
+		require.True(t, deactivated)
+
+		deactivated, err = EnsureDeactivated(context.Background(), client, "existing")
+
+		require.NoError(t, err)
+		require.False(t, deactivated)
+		_, err = SubjectDIDs(context.Background(), client, "existing")
+		require.ErrorIs(t, err, ErrSubjectNotFound)
+	})
+}
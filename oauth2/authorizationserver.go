@@ -24,6 +24,8 @@ type ProtectedResourceMetadata struct {
 	// BearerMethodsSupported contains a JSON array containing a list of the supported methods of sending an OAuth 2.0 Bearer Token [RFC6750]
 	// to the protected resource. Defined values are ["header", "body", "query"], corresponding to Sections 2.1, 2.2, and 2.3 of RFC 6750.
 	BearerMethodsSupported []string `json:"bearer_methods_supported"`
+	// ScopesSupported contains a JSON array containing a list of the OAuth 2.0 scope values that are used in authorization requests to request access to this protected resource.
+	ScopesSupported []string `json:"scopes_supported,omitempty"`
 }
 
 // MetadataLoader loads metadata from a URL and unmarshals it into a target struct.
@@ -0,0 +1,126 @@
+package oauth2
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+)
+
+// WellKnownProtectedResourceMetadataPath is the well-known path of protected resource metadata,
+// as specified by https://www.ietf.org/archive/id/draft-ietf-oauth-resource-metadata-07.html
+const WellKnownProtectedResourceMetadataPath = "/.well-known/oauth-protected-resource"
+
+// MetadataPaths returns the paths at which the protected resource metadata should be served:
+//   - the well-known path with the path of the resource identifier appended, as specified by the draft RFC,
+//   - the path of the resource identifier with the well-known path appended, as used by WithResourceURI.
+//
+// If the resource identifier has no path, both are equal to WellKnownProtectedResourceMetadataPath.
+func (m ProtectedResourceMetadata) MetadataPaths() ([]string, error) {
+	resource, err := url.Parse(m.Resource)
+	if err != nil {
+		return nil, fmt.Errorf("invalid resource identifier: %w", err)
+	}
+	resourcePath := strings.TrimSuffix(resource.EscapedPath(), "/")
+	if resourcePath == "" {
+		return []string{WellKnownProtectedResourceMetadataPath}, nil
+	}
+	return []string{
+		WellKnownProtectedResourceMetadataPath + resourcePath,
+		resourcePath + WellKnownProtectedResourceMetadataPath,
+	}, nil
+}
+
+// ProtectedResourceMetadataHandler returns a handler that serves the protected resource metadata at its MetadataPaths,
+// so the resource server can be discovered by ProtectedResourceMetadataLocator.
+// Requests to other paths are answered with 404 Not Found, so the handler can be registered at multiple (or all) paths.
+func ProtectedResourceMetadataHandler(metadata ProtectedResourceMetadata) (http.Handler, error) {
+	if metadata.Resource == "" {
+		return nil, errors.New("resource identifier is required")
+	}
+	paths, err := metadata.MetadataPaths()
+	if err != nil {
+		return nil, err
+	}
+	data, err := json.Marshal(metadata)
+	if err != nil {
+		return nil, err
+	}
+	return http.HandlerFunc(func(response http.ResponseWriter, httpRequest *http.Request) {
+		if !slices.Contains(paths, strings.TrimSuffix(httpRequest.URL.EscapedPath(), "/")) {
+			http.NotFound(response, httpRequest)
+			return
+		}
+		if httpRequest.Method != http.MethodGet && httpRequest.Method != http.MethodHead {
+			response.Header().Set("Allow", "GET, HEAD")
+			http.Error(response, "Method Not Allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		response.Header().Set("Content-Type", "application/json")
+		response.WriteHeader(http.StatusOK)
+		_, _ = response.Write(data)
+	}), nil
+}
+
+// Challenge is an authentication challenge of a resource server, sent in the WWW-Authenticate response header
+// as specified by RFC6750 (section 3), RFC9449 (section 7.1) and the protected resource metadata draft RFC (section 5.1).
+type Challenge struct {
+	// Scheme is the authentication scheme, e.g. Bearer or DPoP. If not set, Bearer is used.
+	Scheme string
+	// Error is the error code, e.g. invalid_request, invalid_token or insufficient_scope.
+	// It should be empty if the request didn't contain any authentication information.
+	Error string
+	// ErrorDescription is an optional human-readable explanation of the error.
+	ErrorDescription string
+	// Scope is the optional scope necessary to access the requested resource.
+	Scope string
+	// ResourceMetadata is the optional URL of the protected resource metadata.
+	ResourceMetadata string
+}
+
+// StatusCode returns the HTTP status code that belongs to the challenge's error code.
+func (c Challenge) StatusCode() int {
+	switch c.Error {
+	case "invalid_request":
+		return http.StatusBadRequest
+	case "insufficient_scope":
+		return http.StatusForbidden
+	default:
+		return http.StatusUnauthorized
+	}
+}
+
+// String returns the challenge in the form of a WWW-Authenticate header value.
+func (c Challenge) String() string {
+	scheme := c.Scheme
+	if scheme == "" {
+		scheme = "Bearer"
+	}
+	var params []string
+	for _, param := range [][2]string{
+		{"error", c.Error},
+		{"error_description", c.ErrorDescription},
+		{"scope", c.Scope},
+		{"resource_metadata", c.ResourceMetadata},
+	} {
+		if param[1] != "" {
+			params = append(params, fmt.Sprintf(`%s="%s"`, param[0], quoteEscaper.Replace(param[1])))
+		}
+	}
+	if len(params) == 0 {
+		return scheme
+	}
+	return scheme + " " + strings.Join(params, ", ")
+}
+
+var quoteEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`)
+
+// WriteChallenge responds with the challenge in the WWW-Authenticate header and the status code that belongs to its error code.
+func WriteChallenge(response http.ResponseWriter, challenge Challenge) {
+	response.Header().Set("WWW-Authenticate", challenge.String())
+	statusCode := challenge.StatusCode()
+	http.Error(response, http.StatusText(statusCode), statusCode)
+}
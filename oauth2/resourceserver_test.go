@@ -0,0 +1,112 @@
+package oauth2
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestProtectedResourceMetadata_MetadataPaths(t *testing.T) {
+	t.Run("resource without path", func(t *testing.T) {
+		paths, err := ProtectedResourceMetadata{Resource: "https://resource.example.com"}.MetadataPaths()
+
+		require.NoError(t, err)
+		require.Equal(t, []string{"/.well-known/oauth-protected-resource"}, paths)
+	})
+	t.Run("resource with path", func(t *testing.T) {
+		paths, err := ProtectedResourceMetadata{Resource: "https://resource.example.com/fhir/"}.MetadataPaths()
+
+		require.NoError(t, err)
+		require.Equal(t, []string{"/.well-known/oauth-protected-resource/fhir", "/fhir/.well-known/oauth-protected-resource"}, paths)
+	})
+}
+
+func TestProtectedResourceMetadataHandler(t *testing.T) {
+	metadata := ProtectedResourceMetadata{
+		Resource:               "https://resource.example.com/fhir",
+		AuthorizationServers:   []string{"https://example.com/auth"},
+		BearerMethodsSupported: []string{"header"},
+	}
+	handler, err := ProtectedResourceMetadataHandler(metadata)
+	require.NoError(t, err)
+
+	t.Run("path-suffixed", func(t *testing.T) {
+		response := httptest.NewRecorder()
+
+		handler.ServeHTTP(response, httptest.NewRequest(http.MethodGet, "/.well-known/oauth-protected-resource/fhir", nil))
+
+		require.Equal(t, http.StatusOK, response.Code)
+		require.Equal(t, "application/json", response.Header().Get("Content-Type"))
+		var actual ProtectedResourceMetadata
+		require.NoError(t, json.Unmarshal(response.Body.Bytes(), &actual))
+		require.Equal(t, metadata, actual)
+	})
+	t.Run("other path", func(t *testing.T) {
+		response := httptest.NewRecorder()
+
+		handler.ServeHTTP(response, httptest.NewRequest(http.MethodGet, "/.well-known/oauth-protected-resource", nil))
+
+		require.Equal(t, http.StatusNotFound, response.Code)
+	})
+	t.Run("method not allowed", func(t *testing.T) {
+		response := httptest.NewRecorder()
+
+		handler.ServeHTTP(response, httptest.NewRequest(http.MethodPost, "/fhir/.well-known/oauth-protected-resource", nil))
+
+		require.Equal(t, http.StatusMethodNotAllowed, response.Code)
+	})
+	t.Run("discoverable by ProtectedResourceMetadataLocator", func(t *testing.T) {
+		httpServer := httptest.NewServer(handler)
+		ctx := WithResourceURI(context.Background(), httpServer.URL+"/fhir")
+		httpRequest, _ := http.NewRequestWithContext(ctx, http.MethodGet, httpServer.URL+"/fhir/Patient", nil)
+
+		actual, err := ProtectedResourceMetadataLocator(&MetadataLoader{}, &http.Response{Request: httpRequest})
+
+		require.NoError(t, err)
+		require.Equal(t, "https://example.com/auth", actual.String())
+	})
+	t.Run("resource identifier is required", func(t *testing.T) {
+		_, err := ProtectedResourceMetadataHandler(ProtectedResourceMetadata{})
+
+		require.EqualError(t, err, "resource identifier is required")
+	})
+}
+
+func TestWriteChallenge(t *testing.T) {
+	t.Run("insufficient scope", func(t *testing.T) {
+		response := httptest.NewRecorder()
+
+		WriteChallenge(response, Challenge{
+			Error:            "insufficient_scope",
+			ErrorDescription: `scope "read" is required`,
+			Scope:            "read",
+			ResourceMetadata: "https://resource.example.com/.well-known/oauth-protected-resource",
+		})
+
+		require.Equal(t, http.StatusForbidden, response.Code)
+		require.Equal(t, `Bearer error="insufficient_scope", error_description="scope \"read\" is required", scope="read", resource_metadata="https://resource.example.com/.well-known/oauth-protected-resource"`, response.Header().Get("WWW-Authenticate"))
+	})
+	t.Run("no authentication information", func(t *testing.T) {
+		response := httptest.NewRecorder()
+
+		WriteChallenge(response, Challenge{Scheme: "DPoP"})
+
+		require.Equal(t, http.StatusUnauthorized, response.Code)
+		require.Equal(t, "DPoP", response.Header().Get("WWW-Authenticate"))
+	})
+	t.Run("parseable by ParseProtectedResourceMetadataURL", func(t *testing.T) {
+		response := httptest.NewRecorder()
+
+		WriteChallenge(response, Challenge{
+			Error:            "invalid_token",
+			ErrorDescription: "token expired, please retry",
+			ResourceMetadata: "https://resource.example.com/.well-known/oauth-protected-resource",
+		})
+
+		actual := ParseProtectedResourceMetadataURL(response.Result())
+		require.Equal(t, "https://resource.example.com/.well-known/oauth-protected-resource", actual.String())
+	})
+}